@@ -15,6 +15,7 @@ import (
 	"github.com/stairlin/lego/bg"
 	"github.com/stairlin/lego/cache"
 	cacheA "github.com/stairlin/lego/cache/adapter"
+	"github.com/stairlin/lego/circuit"
 	"github.com/stairlin/lego/config"
 	"github.com/stairlin/lego/ctx/app"
 	"github.com/stairlin/lego/disco"
@@ -148,7 +149,7 @@ func NewWithConfig(
 
 	// Start background services
 	a.BG().Dispatch(a.stats)
-	a.BG().Dispatch(&hearbeat{app: a})
+	a.BG().Dispatch(newHeartbeat(a))
 
 	if err := a.schedule.Start(a.appCtx); err != nil {
 		return nil, errors.Wrap(err, "error starting scheduler")
@@ -226,6 +227,11 @@ func (a *App) BG() *bg.Reg {
 	return a.bg
 }
 
+// Circuit returns the circuit breaker registry
+func (a *App) Circuit() *circuit.Reg {
+	return a.appCtx.Circuit()
+}
+
 func (a *App) Cache() cache.Cache {
 	return a.cache
 }
@@ -288,6 +294,9 @@ func (a *App) Close() error {
 
 func (a *App) close() {
 	a.schedule.Close()
+	if err := a.cache.Close(); err != nil {
+		a.Error("lego.close.cache", "Error closing cache", log.Error(err))
+	}
 	a.appCtx.Cancel()
 	a.log.Close()
 
@@ -324,6 +333,11 @@ type ServiceRegistration struct {
 	Server net.Server
 	// Tags for that service (versioning, blue-green, whatever)
 	Tags []string
+	// Meta contains arbitrary key/value pairs (optional)
+	Meta map[string]string
+	// Weight is the relative amount of traffic that instance should receive
+	// (optional)
+	Weight int
 }
 
 // RegisterService adds the server to the list of managed servers and registers
@@ -332,11 +346,13 @@ func (a *App) RegisterService(r *ServiceRegistration) {
 	a.servers.Add(net.JoinHostPort(r.Host, strconv.Itoa(int(r.Port))), r.Server)
 
 	a.registrations = append(a.registrations, &disco.Registration{
-		ID:   r.ID,
-		Name: r.Name,
-		Addr: r.Host,
-		Port: r.Port,
-		Tags: append(r.Tags, a.service),
+		ID:     r.ID,
+		Name:   r.Name,
+		Addr:   r.Host,
+		Port:   r.Port,
+		Tags:   append(r.Tags, a.service),
+		Meta:   r.Meta,
+		Weight: r.Weight,
 	})
 }
 
@@ -7,6 +7,13 @@
 // be used for services that run infinitely like heartbeat signals or stats
 // worker.
 //
+// Jobs which need to run at a regular interval can be built with NewPeriodic,
+// and jobs can be dispatched to pools to limit how many of them run
+// concurrently (see AddPool).
+//
+// Panics are recovered and logged by the registry. A job can be supervised, so
+// that it is restarted when it returns or fails (see WithRestart).
+//
 // Package bg guarantee that a dispatched job will be started even a registry
 // is being asked to drain right after. However, there is a slim chance that
 // Stop() is called before Start().
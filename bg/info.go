@@ -0,0 +1,90 @@
+package bg
+
+import (
+	"sort"
+	"time"
+)
+
+// State is the state of a registered job
+type State uint8
+
+const (
+	// Starting jobs are waiting for a worker or to be restarted
+	Starting State = iota
+	// Running jobs have been started
+	Running
+	// Stopping jobs have been asked to stop
+	Stopping
+)
+
+func (s State) String() string {
+	switch s {
+	case Starting:
+		return "starting"
+	case Running:
+		return "running"
+	case Stopping:
+		return "stopping"
+	default:
+		return "unknown"
+	}
+}
+
+// Progresser is implemented by jobs which can report their progress
+// (e.g. "12/40 files uploaded")
+type Progresser interface {
+	Job
+	Progress() string
+}
+
+// JobInfo describes a registered job
+type JobInfo struct {
+	Name     string
+	State    State
+	Started  time.Time // Last time it has been started
+	Restarts int
+	Progress string
+	LastErr  string
+}
+
+// Jobs returns a snapshot of all registered jobs, sorted by name
+func (r *Reg) Jobs() []JobInfo {
+	r.mu.Lock()
+	l := make([]*status, 0, len(r.jobs))
+	for _, s := range r.jobs {
+		l = append(l, s)
+	}
+	r.mu.Unlock()
+
+	jobs := make([]JobInfo, len(l))
+	for i, s := range l {
+		jobs[i] = s.info()
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Name != jobs[j].Name {
+			return jobs[i].Name < jobs[j].Name
+		}
+		return jobs[i].Started.Before(jobs[j].Started)
+	})
+	return jobs
+}
+
+func (s *status) info() JobInfo {
+	s.mu.Lock()
+	info := JobInfo{
+		Name:     s.name,
+		State:    s.state,
+		Started:  s.since,
+		Restarts: s.restarts,
+	}
+	if s.err != nil {
+		info.LastErr = s.err.Error()
+	}
+	s.mu.Unlock()
+
+	// The job is called without holding the status lock
+	if p, ok := s.job.(Progresser); ok {
+		info.Progress = p.Progress()
+	}
+	return info
+}
@@ -0,0 +1,87 @@
+package bg_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/bg"
+	lt "github.com/stairlin/lego/testing"
+)
+
+// TestJobs tests whether the registry reports what is running
+func TestJobs(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestJobs", tt.Logger(), tt.Stats())
+	if err := reg.AddPool("p", 1); err != nil {
+		t.Fatal("expect to be able to add pool", err)
+	}
+
+	release := make(chan struct{})
+	running := &ProgressJob{Task: bg.NewTask(func() { <-release })}
+	queued := bg.NewTask(func() {})
+	if err := reg.Dispatch(running, bg.Named("a"), bg.InPool("p")); err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := reg.Dispatch(queued, bg.Named("b"), bg.InPool("p")); err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	jobs := reg.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("expect 2 jobs, but got %d", len(jobs))
+	}
+	if jobs[0].Name != "a" || jobs[0].State != bg.Running {
+		t.Errorf("expect job a to be running, but got %s %s", jobs[0].Name, jobs[0].State)
+	}
+	if jobs[0].Progress != "half way" {
+		t.Errorf("expect job a to report its progress, but got %q", jobs[0].Progress)
+	}
+	if jobs[0].Started.IsZero() {
+		t.Error("expect job a to have a start time")
+	}
+	if jobs[1].Name != "b" || jobs[1].State != bg.Starting {
+		t.Errorf("expect job b to be starting, but got %s %s", jobs[1].Name, jobs[1].State)
+	}
+
+	close(release)
+	reg.Drain()
+}
+
+// TestJobsLastErr tests whether the last error of a job is reported
+func TestJobsLastErr(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestJobsLastErr", tt.Logger(), tt.Stats())
+
+	job := &FailingJob{fail: true, done: make(chan struct{}, 10)}
+	err := reg.Dispatch(job,
+		bg.WithRestart(bg.OnFailure),
+		bg.WithBackoff(time.Hour, time.Hour),
+	)
+	if err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+	<-job.done
+	time.Sleep(time.Millisecond)
+
+	jobs := reg.Jobs()
+	if len(jobs) != 1 {
+		t.Fatalf("expect 1 job, but got %d", len(jobs))
+	}
+	if jobs[0].Name != "bg_test.FailingJob" {
+		t.Errorf("expect job to be named after its type, but got %s", jobs[0].Name)
+	}
+	if jobs[0].LastErr != "failed" {
+		t.Errorf("expect last error to be reported, but got %q", jobs[0].LastErr)
+	}
+	reg.Drain()
+}
+
+// ProgressJob is a task which reports its progress
+type ProgressJob struct {
+	*bg.Task
+}
+
+func (j *ProgressJob) Progress() string {
+	return "half way"
+}
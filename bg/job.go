@@ -2,7 +2,10 @@ package bg
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/stairlin/lego/log"
 	"github.com/stairlin/lego/stats"
@@ -30,6 +33,8 @@ type Reg struct {
 	log     log.Logger
 	stats   stats.Stats
 	jobs    map[Job]*status
+	names   map[string]int
+	pools   map[string]*pool
 }
 
 // NewReg builds a new registry
@@ -39,26 +44,110 @@ func NewReg(service string, log log.Logger, stats stats.Stats) *Reg {
 		log:     log,
 		stats:   stats,
 		jobs:    map[Job]*status{},
+		names:   map[string]int{},
+		pools:   map[string]*pool{},
 	}
 }
 
+// DispatchOption configures how we dispatch a job
+type DispatchOption func(*DispatchOptions)
+
+// DispatchOptions configure a dispatch. DispatchOptions are set by the
+// DispatchOption values passed to Dispatch.
+type DispatchOptions struct {
+	Pool        string
+	Name        string
+	Restart     Restart
+	MaxRestarts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// InPool runs the job on the given pool, rather than on its own goroutine
+func InPool(name string) DispatchOption {
+	return func(o *DispatchOptions) {
+		o.Pool = name
+	}
+}
+
+// AddPool adds a pool of max workers to the registry. Jobs dispatched to
+// that pool will wait for a worker to be available before being started.
+// (e.g. map.update - max 4)
+func (r *Reg) AddPool(name string, max int, o ...PoolOption) error {
+	opts := PoolOptions{
+		Queue:    DefaultPoolQueue,
+		Overflow: Block,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+	if max < 1 || opts.Queue < 0 {
+		return ErrInvalidPool
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.pools[name]; ok {
+		return ErrDupPool
+	}
+	r.pools[name] = newPool(name, max, opts, r.service, r.stats)
+	return nil
+}
+
 // Dispatch registers the given job and runs it in background
-func (r *Reg) Dispatch(j Job) error {
+//
+// When the job is dispatched to a pool, Dispatch may block until there is
+// enough room in the pool queue, or fail with ErrPoolFull. It fails with
+// ErrDrain as soon as the registry drains.
+func (r *Reg) Dispatch(j Job, o ...DispatchOption) error {
+	opts := DispatchOptions{
+		Name:       strings.TrimPrefix(fmt.Sprintf("%T", j), "*"),
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+
+	// Reserve a place in the pool (this might block)
+	var p *pool
+	if opts.Pool != "" {
+		r.mu.Lock()
+		p = r.pools[opts.Pool]
+		r.mu.Unlock()
+		if p == nil {
+			return ErrPoolNotFound
+		}
+		if err := p.admit(); err != nil {
+			return err
+		}
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	// Do not accept new jobs when the registry is draining
 	if r.drain {
+		if p != nil {
+			p.cancel()
+		}
 		return ErrDrain
 	}
 
 	// Ensure that it has not been already accepted
 	if _, ok := r.jobs[j]; ok {
+		if p != nil {
+			p.cancel()
+		}
 		return ErrDup
 	}
 
 	// Add it to registry
-	s := r.register(j)
+	s := r.register(j, opts.Name)
+	if b, ok := j.(binder); ok {
+		b.bind(r.service, r.log, r.stats)
+	}
 
 	go func() {
 		// Deregister itself upon completion
@@ -68,13 +157,16 @@ func (r *Reg) Dispatch(j Job) error {
 			r.mu.Unlock()
 		}()
 
+		// Wait for a worker
+		if p != nil {
+			p.acquire()
+			defer p.release()
+		}
+
 		// Start job
-		r.log.Trace("bg.job.start", "Start job",
-			log.Type("j", j),
-			log.Ptr("addr", j),
-		)
+		s.begin()
 		s.started <- struct{}{}
-		j.Start()
+		r.supervise(j, s, &opts)
 	}()
 
 	return nil
@@ -89,27 +181,42 @@ func (r *Reg) Drain() {
 		return
 	}
 	r.drain = true
+	for _, p := range r.pools {
+		p.close()
+	}
+
+	// Copy jobs, since they deregister themselves upon completion
+	jobs := make(map[Job]*status, len(r.jobs))
+	for j, s := range r.jobs {
+		jobs[j] = s
+	}
 
 	// Build WG
 	wg := &sync.WaitGroup{}
-	wg.Add(len(r.jobs))
+	wg.Add(len(jobs))
 
 	// Release lock
 	r.mu.Unlock()
 
 	// Start draining jobs
 	r.log.Trace("bg.drain.start", "Draining registry",
-		log.Int("jobs", len(r.jobs)),
+		log.Int("jobs", len(jobs)),
 	)
-	for j, s := range r.jobs {
+	for j, s := range jobs {
 		go func(j Job, s *status) {
 			defer wg.Done()
 
 			// Wait for job to be started
 			<-s.started
 
+			// Prevent it from being restarted
+			if !s.halt() {
+				return
+			}
+
 			// Stop job
 			r.log.Trace("bg.job.stop", "Stop job",
+				log.String("name", s.name),
 				log.Type("j", j),
 				log.Ptr("addr", j),
 			)
@@ -121,28 +228,99 @@ func (r *Reg) Drain() {
 	r.log.Trace("bg.drain.done", "Registry drained")
 }
 
-func (r *Reg) register(j Job) *status {
+func (r *Reg) register(j Job, name string) *status {
 	s := &status{
+		job:     j,
+		name:    name,
 		started: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
 	}
 	r.jobs[j] = s
+	r.names[name]++
 
-	r.addStats()
+	r.addStats(name)
 
 	return s
 }
 
 func (r *Reg) deregister(j Job) {
+	s := r.jobs[j]
 	delete(r.jobs, j)
-	r.addStats()
+	r.names[s.name]--
+	r.addStats(s.name)
+	if r.names[s.name] == 0 {
+		delete(r.names, s.name)
+	}
+}
+
+func (r *Reg) addStats(name string) {
+	r.stats.Gauge("bg.jobs", r.names[name], r.tags(name))
 }
 
-func (r *Reg) addStats() {
-	r.stats.Gauge("bg.jobs", len(r.jobs), map[string]string{
+func (r *Reg) tags(name string) map[string]string {
+	return map[string]string{
 		"service": r.service,
-	})
+		"name":    name,
+	}
+}
+
+// binder is implemented by jobs which use the registry dependencies
+type binder interface {
+	bind(service string, l log.Logger, s stats.Stats)
 }
 
 type status struct {
-	started chan struct{}
+	mu sync.Mutex
+
+	job      Job
+	name     string
+	started  chan struct{}
+	stop     chan struct{}
+	state    State
+	since    time.Time
+	restarts int
+	err      error
+}
+
+// begin marks the job as running, unless it is being stopped
+func (s *status) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == Stopping {
+		return false
+	}
+	if !s.since.IsZero() {
+		s.restarts++
+	}
+	s.state = Running
+	s.since = time.Now()
+	return true
+}
+
+// end marks the job as returned with the given error
+func (s *status) end(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == Running {
+		s.state = Starting
+	}
+	if err != nil {
+		s.err = err
+	}
+}
+
+// halt prevents the job from being restarted and returns whether it is
+// still running
+func (s *status) halt() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := s.state == Running
+	if s.state != Stopping {
+		s.state = Stopping
+		close(s.stop)
+	}
+	return running
 }
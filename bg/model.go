@@ -16,10 +16,14 @@ func NewTask(f func()) *Task {
 	}
 }
 
+// Start calls the task function. A panic is not recovered, so that it can be
+// reported by the registry.
 func (t *Task) Start() {
 	defer func() {
-		recover()
-		t.done <- struct{}{}
+		select {
+		case t.done <- struct{}{}:
+		default:
+		}
 	}()
 
 	t.f()
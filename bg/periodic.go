@@ -0,0 +1,251 @@
+package bg
+
+import (
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/stairlin/lego/log"
+	"github.com/stairlin/lego/stats"
+)
+
+// Overlap defines what happens when a periodic job is due while its previous
+// run is still in progress
+type Overlap uint8
+
+const (
+	// Skip drops the run
+	Skip Overlap = iota
+	// Enqueue runs it as soon as the previous run is done. Due runs are
+	// coalesced, so at most one run can be pending.
+	Enqueue
+)
+
+// PeriodicOption configures how we set up a periodic job
+type PeriodicOption func(*PeriodicOptions)
+
+// PeriodicOptions configure a periodic job. PeriodicOptions are set by the
+// PeriodicOption values passed to NewPeriodic.
+type PeriodicOptions struct {
+	Name      string
+	Jitter    float64
+	Immediate bool
+	Overlap   Overlap
+}
+
+// WithName sets the name used to log and measure the job
+func WithName(name string) PeriodicOption {
+	return func(o *PeriodicOptions) {
+		o.Name = name
+	}
+}
+
+// WithJitter adds a random delay to each interval, up to the given fraction
+// of the interval (e.g. 0.1 = up to 10%). It prevents instances which have
+// been started at the same time from running in lockstep.
+func WithJitter(fraction float64) PeriodicOption {
+	return func(o *PeriodicOptions) {
+		o.Jitter = fraction
+	}
+}
+
+// WithImmediate runs the job as soon as it is started, rather than waiting
+// for the first interval to elapse
+func WithImmediate() PeriodicOption {
+	return func(o *PeriodicOptions) {
+		o.Immediate = true
+	}
+}
+
+// WithOverlap sets what happens when a run is due while the previous one is
+// still in progress.
+//
+// When omitted from the parameters, the run is skipped.
+func WithOverlap(ov Overlap) PeriodicOption {
+	return func(o *PeriodicOptions) {
+		o.Overlap = ov
+	}
+}
+
+// Periodic is a background job which calls a function at a regular interval
+// until it is stopped.
+//
+// A panicking run is recovered and logged, and it does not prevent the next
+// runs from being executed.
+type Periodic struct {
+	interval time.Duration
+	f        func()
+	opts     PeriodicOptions
+
+	service string
+	log     log.Logger
+	stats   stats.Stats
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPeriodic returns a job which calls f every interval. It panics when
+// interval is not positive.
+func NewPeriodic(interval time.Duration, f func(), o ...PeriodicOption) *Periodic {
+	if interval <= 0 {
+		panic("bg: non-positive interval for NewPeriodic")
+	}
+
+	opts := PeriodicOptions{
+		Name:    "periodic",
+		Overlap: Skip,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+
+	return &Periodic{
+		interval: interval,
+		f:        f,
+		opts:     opts,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start calls the function periodically and blocks until the job is stopped.
+// A stopped job can be started again.
+func (p *Periodic) Start() {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+		// Restarted once the previous run has returned
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+	default:
+	}
+	stop, done := p.stop, p.done
+	p.mu.Unlock()
+	defer close(done)
+
+	// An unbuffered trigger is only accepted when the worker is idle, whereas a
+	// buffered one holds a pending run
+	var trigger chan struct{}
+	if p.opts.Overlap == Enqueue {
+		trigger = make(chan struct{}, 1)
+	} else {
+		trigger = make(chan struct{})
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range trigger {
+			p.run()
+		}
+	}()
+	defer func() {
+		close(trigger)
+		wg.Wait()
+	}()
+
+	if p.opts.Immediate {
+		select {
+		case trigger <- struct{}{}:
+		case <-stop:
+			return
+		}
+	}
+
+	timer := time.NewTimer(p.next())
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+			select {
+			case trigger <- struct{}{}:
+			default:
+				p.skipped()
+			}
+			timer.Reset(p.next())
+		}
+	}
+}
+
+// Stop stops the job and waits for the run in progress to complete.
+// It must not be called before Start.
+func (p *Periodic) Stop() {
+	p.mu.Lock()
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	done := p.done
+	p.mu.Unlock()
+	<-done
+}
+
+// bind gives access to the registry dependencies
+func (p *Periodic) bind(service string, l log.Logger, s stats.Stats) {
+	p.service = service
+	p.log = l
+	p.stats = s
+}
+
+func (p *Periodic) run() {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			if p.log != nil {
+				p.log.Error("bg.periodic.panic", "Recovered from panic",
+					log.String("name", p.opts.Name),
+					log.Object("err", r),
+					log.String("stack", string(debug.Stack())),
+				)
+			}
+			p.inc("bg.periodic.panics")
+		}
+		p.timing("bg.periodic.run", time.Since(start))
+	}()
+
+	p.f()
+}
+
+// next returns the delay before the next run
+func (p *Periodic) next() time.Duration {
+	d := p.interval
+	if p.opts.Jitter > 0 {
+		d += time.Duration(rand.Float64() * p.opts.Jitter * float64(p.interval))
+	}
+	return d
+}
+
+func (p *Periodic) skipped() {
+	if p.log != nil {
+		p.log.Trace("bg.periodic.skip", "Previous run still in progress",
+			log.String("name", p.opts.Name),
+		)
+	}
+	p.inc("bg.periodic.skipped")
+}
+
+func (p *Periodic) inc(key string) {
+	if p.stats != nil {
+		p.stats.Inc(key, p.tags())
+	}
+}
+
+func (p *Periodic) timing(key string, d time.Duration) {
+	if p.stats != nil {
+		p.stats.Timing(key, d, p.tags())
+	}
+}
+
+func (p *Periodic) tags() map[string]string {
+	return map[string]string{
+		"service": p.service,
+		"name":    p.opts.Name,
+	}
+}
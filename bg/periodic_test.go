@@ -0,0 +1,168 @@
+package bg_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/bg"
+	lt "github.com/stairlin/lego/testing"
+)
+
+// TestPeriodicRuns tests whether a periodic job runs until the registry drains
+func TestPeriodicRuns(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPeriodicRuns", tt.Logger(), tt.Stats())
+
+	var n int32
+	p := bg.NewPeriodic(time.Millisecond, func() {
+		atomic.AddInt32(&n, 1)
+	}, bg.WithJitter(0.5))
+	if err := reg.Dispatch(p); err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	reg.Drain()
+	runs := atomic.LoadInt32(&n)
+	if runs < 2 {
+		t.Errorf("expect job to run several times, but got %d", runs)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if got := atomic.LoadInt32(&n); got != runs {
+		t.Errorf("expect job to stop running once drained (%d != %d)", got, runs)
+	}
+}
+
+// TestPeriodicImmediate tests whether a job can run as soon as it is started
+func TestPeriodicImmediate(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPeriodicImmediate", tt.Logger(), tt.Stats())
+
+	ran := make(chan struct{}, 1)
+	p := bg.NewPeriodic(time.Hour, func() {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	}, bg.WithImmediate())
+	if err := reg.Dispatch(p); err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Error("expect job to run immediately")
+	}
+	reg.Drain()
+}
+
+// TestPeriodicOverlap tests whether due runs are skipped or queued when the
+// previous run is still in progress
+func TestPeriodicOverlap(t *testing.T) {
+	for name, ov := range map[string]bg.Overlap{"skip": bg.Skip, "enqueue": bg.Enqueue} {
+		t.Run(name, func(t *testing.T) {
+			tt := lt.New(t)
+			reg := bg.NewReg("TestPeriodicOverlap", tt.Logger(), tt.Stats())
+
+			var running, overlaps, n int32
+			p := bg.NewPeriodic(time.Millisecond, func() {
+				if atomic.AddInt32(&running, 1) > 1 {
+					atomic.AddInt32(&overlaps, 1)
+				}
+				atomic.AddInt32(&n, 1)
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			}, bg.WithOverlap(ov))
+			if err := reg.Dispatch(p); err != nil {
+				t.Fatal("expect to be able to dispatch job", err)
+			}
+
+			time.Sleep(30 * time.Millisecond)
+			reg.Drain()
+
+			if overlaps > 0 {
+				t.Errorf("expect runs not to overlap, but got %d", overlaps)
+			}
+			if n == 0 || n > 7 {
+				t.Errorf("expect at most one run every 5ms, but got %d", n)
+			}
+		})
+	}
+}
+
+// TestPeriodicPanic tests whether a panicking run does not stop the job
+func TestPeriodicPanic(t *testing.T) {
+	tt := lt.New(t)
+	tt.DisableStrictMode()
+	reg := bg.NewReg("TestPeriodicPanic", tt.Logger(), tt.Stats())
+
+	var n int32
+	p := bg.NewPeriodic(time.Millisecond, func() {
+		atomic.AddInt32(&n, 1)
+		panic("oops")
+	})
+	if err := reg.Dispatch(p); err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	reg.Drain()
+	if got := atomic.LoadInt32(&n); got < 2 {
+		t.Errorf("expect job to keep running after a panic, but got %d runs", got)
+	}
+	if tt.Logger().(*lt.Logger).Lines(lt.ER) == 0 {
+		t.Error("expect panics to be logged")
+	}
+}
+
+// TestPeriodicRestart tests whether a stopped job can be started again
+func TestPeriodicRestart(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	p := bg.NewPeriodic(time.Millisecond, func() {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		returned := make(chan struct{})
+		go func() {
+			p.Start()
+			close(returned)
+		}()
+
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatalf("expect job to run after start #%d", i+1)
+		}
+		p.Stop()
+		select {
+		case <-returned:
+		case <-time.After(time.Second):
+			t.Fatalf("expect start #%d to return once stopped", i+1)
+		}
+		select {
+		case <-ran:
+		default:
+		}
+	}
+}
+
+// TestPeriodicInterval tests whether non-positive intervals are rejected
+func TestPeriodicInterval(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expect interval %s to be rejected", d)
+				}
+			}()
+			bg.NewPeriodic(d, func() {})
+		}()
+	}
+}
@@ -0,0 +1,176 @@
+package bg
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/stairlin/lego/stats"
+)
+
+const (
+	// DefaultPoolQueue is the default number of jobs that can wait for a
+	// worker of a pool
+	DefaultPoolQueue = 128
+)
+
+var (
+	// ErrPoolFull is the error returned when a job is dispatched to a pool
+	// that rejects overflowing jobs and its queue is full
+	ErrPoolFull = errors.New("pool is full")
+	// ErrPoolNotFound is the error returned when a job is dispatched to a pool
+	// that has not been added to the registry
+	ErrPoolNotFound = errors.New("pool not found")
+	// ErrDupPool is the error returned when a pool has already been added
+	ErrDupPool = errors.New("pool has already been added")
+	// ErrInvalidPool is the error returned when a pool is added without any
+	// worker, or with a negative queue size
+	ErrInvalidPool = errors.New("pool must have at least one worker and a non-negative queue")
+)
+
+// Overflow defines what happens when a job is dispatched to a pool which
+// has a full queue
+type Overflow uint8
+
+const (
+	// Block blocks Dispatch until the job can be queued (backpressure)
+	Block Overflow = iota
+	// Reject rejects the job with ErrPoolFull
+	Reject
+)
+
+// PoolOption configures how we set up a pool
+type PoolOption func(*PoolOptions)
+
+// PoolOptions configure a pool. PoolOptions are set by the PoolOption values
+// passed to AddPool.
+type PoolOptions struct {
+	Queue    int
+	Overflow Overflow
+}
+
+// WithQueue sets how many jobs can wait for a worker.
+//
+// When omitted from the parameters, the queue size is set to 'DefaultPoolQueue'.
+func WithQueue(n int) PoolOption {
+	return func(o *PoolOptions) {
+		o.Queue = n
+	}
+}
+
+// WithOverflow sets what happens when a job is dispatched and the queue is full.
+//
+// When omitted from the parameters, Dispatch blocks until the job can be queued.
+func WithOverflow(ov Overflow) PoolOption {
+	return func(o *PoolOptions) {
+		o.Overflow = ov
+	}
+}
+
+// pool limits the number of jobs running concurrently.
+//
+// A job goes through two steps: it is first admitted in the pool (queued),
+// and then it waits for a worker to be available (running).
+type pool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	name    string
+	max     int
+	opts    PoolOptions
+	service string
+	stats   stats.Stats
+
+	running int
+	queued  int
+	// closed tells whether new jobs are rejected, once the registry drains
+	closed bool
+}
+
+func newPool(
+	name string, max int, opts PoolOptions, service string, stats stats.Stats,
+) *pool {
+	p := &pool{
+		name:    name,
+		max:     max,
+		opts:    opts,
+		service: service,
+		stats:   stats,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// admit reserves a place for a new job in the pool
+func (p *pool) admit() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.running+p.queued >= p.max+p.opts.Queue || p.closed {
+		if p.closed {
+			return ErrDrain
+		}
+		if p.opts.Overflow == Reject {
+			p.stats.Inc("bg.pool.rejected", p.tags())
+			return ErrPoolFull
+		}
+		p.cond.Wait()
+	}
+	p.queued++
+	p.addStats()
+	return nil
+}
+
+// close rejects new jobs, including the ones waiting to be admitted
+func (p *pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+// cancel releases a place reserved by admit
+func (p *pool) cancel() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.queued--
+	p.addStats()
+	p.cond.Broadcast()
+}
+
+// acquire blocks until a worker is available for an admitted job
+func (p *pool) acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.running >= p.max {
+		p.cond.Wait()
+	}
+	p.queued--
+	p.running++
+	p.addStats()
+}
+
+// release frees the worker used by a job
+func (p *pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running--
+	p.addStats()
+	p.cond.Broadcast()
+}
+
+func (p *pool) addStats() {
+	tags := p.tags()
+	p.stats.Gauge("bg.pool.running", p.running, tags)
+	p.stats.Gauge("bg.pool.queued", p.queued, tags)
+}
+
+func (p *pool) tags() map[string]string {
+	return map[string]string{
+		"service": p.service,
+		"pool":    p.name,
+	}
+}
@@ -0,0 +1,190 @@
+package bg_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/bg"
+	lt "github.com/stairlin/lego/testing"
+)
+
+// TestPoolConcurrency tests whether a pool never runs more jobs than its
+// number of workers
+func TestPoolConcurrency(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPoolConcurrency", tt.Logger(), tt.Stats())
+	if err := reg.AddPool("map.update", 4); err != nil {
+		t.Fatal("expect to be able to add pool", err)
+	}
+
+	var running, max int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		err := reg.Dispatch(bg.NewTask(func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}), bg.InPool("map.update"))
+		if err != nil {
+			t.Fatal("expect to be able to dispatch job", err)
+		}
+	}
+	wg.Wait()
+
+	if max > 4 {
+		t.Errorf("expect at most 4 concurrent jobs, but got %d", max)
+	}
+}
+
+// TestPoolReject tests whether a pool rejects jobs when its queue is full
+func TestPoolReject(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPoolReject", tt.Logger(), tt.Stats())
+	err := reg.AddPool("p", 1, bg.WithQueue(1), bg.WithOverflow(bg.Reject))
+	if err != nil {
+		t.Fatal("expect to be able to add pool", err)
+	}
+
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		err := reg.Dispatch(bg.NewTask(func() { <-release }), bg.InPool("p"))
+		if err != nil {
+			t.Fatal("expect to be able to dispatch job", err)
+		}
+	}
+	err = reg.Dispatch(bg.NewTask(func() {}), bg.InPool("p"))
+	if err != bg.ErrPoolFull {
+		t.Errorf("expect job to be rejected when the pool is full (%v)", err)
+	}
+
+	close(release)
+	reg.Drain()
+}
+
+// TestPoolBlock tests whether Dispatch waits for room in the pool queue
+func TestPoolBlock(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPoolBlock", tt.Logger(), tt.Stats())
+	if err := reg.AddPool("p", 1, bg.WithQueue(0)); err != nil {
+		t.Fatal("expect to be able to add pool", err)
+	}
+
+	release := make(chan struct{})
+	err := reg.Dispatch(bg.NewTask(func() { <-release }), bg.InPool("p"))
+	if err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	dispatched := make(chan error, 1)
+	go func() {
+		dispatched <- reg.Dispatch(bg.NewTask(func() {}), bg.InPool("p"))
+	}()
+	select {
+	case <-dispatched:
+		t.Fatal("expect Dispatch to block while the pool is full")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-dispatched:
+		if err != nil {
+			t.Error("expect job to be dispatched once the pool has room", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expect Dispatch to return once the pool has room")
+	}
+}
+
+// TestPoolBlockDrain tests whether a blocked Dispatch returns once the
+// registry drains
+func TestPoolBlockDrain(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPoolBlockDrain", tt.Logger(), tt.Stats())
+	if err := reg.AddPool("p", 1, bg.WithQueue(0)); err != nil {
+		t.Fatal("expect to be able to add pool", err)
+	}
+
+	release := make(chan struct{})
+	err := reg.Dispatch(bg.NewTask(func() { <-release }), bg.InPool("p"))
+	if err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	dispatched := make(chan error, 1)
+	go func() {
+		dispatched <- reg.Dispatch(bg.NewTask(func() {}), bg.InPool("p"))
+	}()
+	select {
+	case <-dispatched:
+		t.Fatal("expect Dispatch to block while the pool is full")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		reg.Drain()
+		close(drained)
+	}()
+	select {
+	case err := <-dispatched:
+		if err != bg.ErrDrain {
+			t.Errorf("expect job to be rejected during drain (%v)", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expect Dispatch to return when the registry drains")
+	}
+
+	// The pool is still full, so new jobs are rejected right away
+	if err := reg.Dispatch(bg.NewTask(func() {}), bg.InPool("p")); err != bg.ErrDrain {
+		t.Errorf("expect job to be rejected during drain (%v)", err)
+	}
+	close(release)
+	<-drained
+}
+
+// TestPoolNotFound tests whether dispatching a job to an unknown pool fails
+func TestPoolNotFound(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPoolNotFound", tt.Logger(), tt.Stats())
+
+	err := reg.Dispatch(bg.NewTask(func() {}), bg.InPool("unknown"))
+	if err != bg.ErrPoolNotFound {
+		t.Errorf("expect dispatch to fail with an unknown pool (%v)", err)
+	}
+	if err := reg.AddPool("p", 1); err != nil {
+		t.Fatal("expect to be able to add pool", err)
+	}
+	if err := reg.AddPool("p", 1); err != bg.ErrDupPool {
+		t.Errorf("expect pool to be added only once (%v)", err)
+	}
+}
+
+// TestPoolInvalid tests whether pools which could never run a job are rejected
+func TestPoolInvalid(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestPoolInvalid", tt.Logger(), tt.Stats())
+
+	if err := reg.AddPool("none", 0); err != bg.ErrInvalidPool {
+		t.Errorf("expect a pool without worker to be rejected (%v)", err)
+	}
+	if err := reg.AddPool("negative", -1); err != bg.ErrInvalidPool {
+		t.Errorf("expect a pool with negative workers to be rejected (%v)", err)
+	}
+	if err := reg.AddPool("queue", 1, bg.WithQueue(-1)); err != bg.ErrInvalidPool {
+		t.Errorf("expect a pool with a negative queue to be rejected (%v)", err)
+	}
+	if err := reg.AddPool("unqueued", 1, bg.WithQueue(0)); err != nil {
+		t.Error("expect a pool without queue to be added", err)
+	}
+}
@@ -0,0 +1,168 @@
+package bg
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/stairlin/lego/log"
+)
+
+const (
+	// DefaultMinBackoff is the default delay before restarting a job for the
+	// first time
+	DefaultMinBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the default maximum delay before restarting a job
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Restart defines whether a job is restarted once it has returned
+type Restart uint8
+
+const (
+	// Never lets the job return (default)
+	Never Restart = iota
+	// OnFailure restarts jobs which have failed
+	OnFailure
+	// Always restarts jobs until the registry drains
+	Always
+)
+
+// Failable is implemented by jobs which can report why they have returned.
+//
+// A job has failed when Start panics, or when Err returns an error once Start
+// has returned.
+type Failable interface {
+	Job
+	Err() error
+}
+
+// Named sets the name used to log and measure the job
+func Named(name string) DispatchOption {
+	return func(o *DispatchOptions) {
+		o.Name = name
+	}
+}
+
+// WithRestart sets the restart policy of the job.
+//
+// When omitted from the parameters, the job is never restarted.
+func WithRestart(policy Restart) DispatchOption {
+	return func(o *DispatchOptions) {
+		o.Restart = policy
+	}
+}
+
+// WithMaxRestarts sets how many times a job can be restarted before giving up.
+//
+// When omitted from the parameters, or set to 0, there is no limit.
+func WithMaxRestarts(n int) DispatchOption {
+	return func(o *DispatchOptions) {
+		o.MaxRestarts = n
+	}
+}
+
+// WithBackoff sets the delay before restarting a job. It starts at min and
+// doubles on every restart, up to max.
+//
+// Non-positive values fall back to DefaultMinBackoff and DefaultMaxBackoff,
+// so that failing jobs are never restarted in a tight loop.
+func WithBackoff(min, max time.Duration) DispatchOption {
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	if max < min {
+		max = min
+	}
+	return func(o *DispatchOptions) {
+		o.MinBackoff = min
+		o.MaxBackoff = max
+	}
+}
+
+// supervise runs the job and restarts it according to its restart policy
+func (r *Reg) supervise(j Job, s *status, opts *DispatchOptions) {
+	for restarts := 0; ; restarts++ {
+		if restarts > 0 && !s.begin() {
+			return
+		}
+		err := r.run(j, s)
+		s.end(err)
+
+		if !opts.restart(err) {
+			return
+		}
+		if opts.MaxRestarts > 0 && restarts >= opts.MaxRestarts {
+			r.log.Warning("bg.job.giveup", "Too many restarts",
+				log.String("name", s.name),
+				log.Int("restarts", restarts),
+				log.Error(err),
+			)
+			return
+		}
+
+		d := opts.backoff(restarts)
+		r.log.Trace("bg.job.restart", "Restart job",
+			log.String("name", s.name),
+			log.Duration("backoff", d),
+			log.Error(err),
+		)
+		r.stats.Inc("bg.job.restarts", r.tags(s.name))
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(d):
+		}
+	}
+}
+
+// run starts the job and returns why it has failed
+func (r *Reg) run(j Job, s *status) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.log.Error("bg.job.panic", "Recovered from panic",
+				log.String("name", s.name),
+				log.Object("err", rec),
+				log.String("stack", string(debug.Stack())),
+			)
+			r.stats.Inc("bg.job.panics", r.tags(s.name))
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+
+	r.log.Trace("bg.job.start", "Start job",
+		log.String("name", s.name),
+		log.Type("j", j),
+		log.Ptr("addr", j),
+	)
+	j.Start()
+	if f, ok := j.(Failable); ok {
+		return f.Err()
+	}
+	return nil
+}
+
+func (o *DispatchOptions) restart(err error) bool {
+	switch o.Restart {
+	case Always:
+		return true
+	case OnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+func (o *DispatchOptions) backoff(restarts int) time.Duration {
+	d := o.MinBackoff
+	for i := 0; i < restarts && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,207 @@
+package bg_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/bg"
+	lt "github.com/stairlin/lego/testing"
+)
+
+// TestRestartPolicies tests whether jobs are restarted according to their
+// restart policy
+func TestRestartPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy bg.Restart
+		fail   bool
+		expect int32
+	}{
+		{name: "never", policy: bg.Never, fail: true, expect: 1},
+		{name: "on-failure/ok", policy: bg.OnFailure, fail: false, expect: 1},
+		{name: "on-failure/err", policy: bg.OnFailure, fail: true, expect: 4},
+		{name: "always", policy: bg.Always, fail: false, expect: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tt := lt.New(t)
+			reg := bg.NewReg("TestRestartPolicies", tt.Logger(), tt.Stats())
+
+			job := &FailingJob{fail: test.fail, done: make(chan struct{}, 10)}
+			err := reg.Dispatch(job,
+				bg.Named("failing"),
+				bg.WithRestart(test.policy),
+				bg.WithMaxRestarts(3),
+				bg.WithBackoff(time.Microsecond, time.Millisecond),
+			)
+			if err != nil {
+				t.Fatal("expect to be able to dispatch job", err)
+			}
+
+			for i := int32(0); i < test.expect; i++ {
+				waitFor(t, job.done, "job to be started")
+			}
+			waitDeregistered(t, reg)
+			if n := atomic.LoadInt32(&job.starts); n != test.expect {
+				t.Errorf("expect job to be started %d times, but got %d", test.expect, n)
+			}
+		})
+	}
+}
+
+// TestPanicRecovery tests whether a panicking job is recovered, logged and
+// restarted
+func TestPanicRecovery(t *testing.T) {
+	tt := lt.New(t)
+	tt.DisableStrictMode()
+	reg := bg.NewReg("TestPanicRecovery", tt.Logger(), tt.Stats())
+
+	var n int32
+	runs := make(chan struct{}, 10)
+	task := bg.NewTask(func() {
+		runs <- struct{}{}
+		if atomic.AddInt32(&n, 1) == 1 {
+			panic("oops")
+		}
+	})
+	err := reg.Dispatch(task,
+		bg.WithRestart(bg.OnFailure),
+		bg.WithBackoff(time.Microsecond, time.Microsecond),
+	)
+	if err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	waitFor(t, runs, "task to run")
+	waitFor(t, runs, "task to be restarted")
+	waitDeregistered(t, reg)
+	if got := atomic.LoadInt32(&n); got != 2 {
+		t.Errorf("expect task to be restarted once after its panic, but got %d runs", got)
+	}
+	if tt.Logger().(*lt.Logger).Lines(lt.ER) != 1 {
+		t.Error("expect panic to be logged")
+	}
+}
+
+// TestRestartDrain tests whether a job is no longer restarted once the
+// registry drains
+func TestRestartDrain(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestRestartDrain", tt.Logger(), tt.Stats())
+
+	job := &FailingJob{fail: true, done: make(chan struct{}, 10)}
+	err := reg.Dispatch(job,
+		bg.WithRestart(bg.Always),
+		bg.WithBackoff(time.Hour, time.Hour),
+	)
+	if err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	waitFor(t, job.done, "job to be started")
+	reg.Drain()
+	waitDeregistered(t, reg)
+	if n := atomic.LoadInt32(&job.starts); n != 1 {
+		t.Errorf("expect job not to be restarted during drain, but got %d starts", n)
+	}
+}
+
+// TestRestartBackoff tests whether a non-positive backoff falls back to the
+// default one
+func TestRestartBackoff(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestRestartBackoff", tt.Logger(), tt.Stats())
+
+	job := &FailingJob{fail: true, done: make(chan struct{}, 100)}
+	err := reg.Dispatch(job,
+		bg.WithRestart(bg.Always),
+		bg.WithBackoff(0, 0),
+	)
+	if err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	waitFor(t, job.done, "job to be started")
+	time.Sleep(bg.DefaultMinBackoff / 2)
+	if n := atomic.LoadInt32(&job.starts); n != 1 {
+		t.Errorf("expect job not to be restarted before the default backoff, but got %d starts", n)
+	}
+	reg.Drain()
+	waitDeregistered(t, reg)
+}
+
+// TestRestartPeriodic tests whether a stopped periodic job is restarted
+func TestRestartPeriodic(t *testing.T) {
+	tt := lt.New(t)
+	reg := bg.NewReg("TestRestartPeriodic", tt.Logger(), tt.Stats())
+
+	ran := make(chan struct{}, 1)
+	p := bg.NewPeriodic(time.Millisecond, func() {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	})
+	err := reg.Dispatch(p,
+		bg.WithRestart(bg.Always),
+		bg.WithBackoff(time.Microsecond, time.Microsecond),
+	)
+	if err != nil {
+		t.Fatal("expect to be able to dispatch job", err)
+	}
+
+	waitFor(t, ran, "job to run")
+	p.Stop()
+	select {
+	case <-ran:
+	default:
+	}
+	waitFor(t, ran, "job to run once restarted")
+	reg.Drain()
+	waitDeregistered(t, reg)
+}
+
+// waitFor waits for a signal on c
+func waitFor(t *testing.T, c <-chan struct{}, what string) {
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatalf("expect %s", what)
+	}
+}
+
+// waitDeregistered waits for all jobs to be deregistered, which happens once
+// they will no longer be restarted
+func waitDeregistered(t *testing.T, reg *bg.Reg) {
+	deadline := time.Now().Add(time.Second)
+	for len(reg.Jobs()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect jobs to be deregistered")
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+// FailingJob is a job which returns immediately with an optional error
+type FailingJob struct {
+	fail   bool
+	starts int32
+	done   chan struct{}
+}
+
+func (j *FailingJob) Start() {
+	atomic.AddInt32(&j.starts, 1)
+	j.done <- struct{}{}
+}
+
+func (j *FailingJob) Stop() {}
+
+func (j *FailingJob) Err() error {
+	if j.fail {
+		return errors.New("failed")
+	}
+	return nil
+}
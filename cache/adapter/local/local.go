@@ -1,54 +1,136 @@
 // Package local provides an LRU cache and cache-filling library that only runs
 // on the local instance.
+//
+// Group contents can optionally be snapshotted to disk when the cache is
+// closed, and restored on the next start, so that a restarted instance does
+// not start cold. Object groups created with cache.WithDecoded only hold
+// decoded objects, so they are not snapshotted.
 package local
 
 import (
 	"sync"
+	"time"
 
 	"github.com/stairlin/lego/cache"
 	"github.com/stairlin/lego/cache/lru"
 	"github.com/stairlin/lego/config"
 	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/log"
 )
 
 // Name is the local cache adapter name
 const Name = "local"
 
+// Config is the local cache configuration
+type Config struct {
+	// Snapshot activates group snapshots (optional)
+	Snapshot *SnapshotConfig `toml:"snapshot"`
+}
+
+// SnapshotConfig is the configuration to persist group contents across restarts
+type SnapshotConfig struct {
+	// DB is the path to the snapshot file
+	DB string `toml:"db"`
+	// Encryption activates data encryption.
+	// It is worth noting that a snapshot encrypted with a key that is no longer
+	// available will be discarded.
+	Encryption *EncryptionConfig `toml:"encryption"`
+}
+
+// EncryptionConfig is the configuration to encrypt snapshots.
+// Snapshots support key rotation, so new keys can be added without
+// affecting existing snapshots.
+type EncryptionConfig struct {
+	// Default is the key to use to encrypt new data
+	Default uint32 `toml:"default"`
+	// Keys contains all encryption keys available
+	Keys []string `toml:"keys"`
+}
+
 type localCache struct {
 	mu sync.Mutex
 
-	groups map[string]*group
+	log      log.Logger
+	groups   map[string]*group
+	snapshot *snapshot
+	// restored contains the snapshotted entries of groups that have not been
+	// created yet
+	restored map[string][]*entry
 }
 
 // New returns a new local cache
-func New(_ config.Tree, _ cache.Dependencies) (cache.Cache, error) {
-	return &localCache{
+func New(tree config.Tree, deps cache.Dependencies) (cache.Cache, error) {
+	c := Config{}
+	if err := tree.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+
+	lc := &localCache{
+		log:    deps.L(),
 		groups: make(map[string]*group),
-	}, nil
+	}
+	if c.Snapshot != nil {
+		s, err := newSnapshot(c.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		lc.snapshot = s
+
+		// A cache can always start cold, so a broken snapshot is not fatal
+		lc.restored, err = s.Load()
+		if err != nil {
+			lc.log.Warning("cache.local.restore.err", "Cannot restore snapshot",
+				log.String("db", c.Snapshot.DB),
+				log.Error(err),
+			)
+		}
+	}
+	return lc, nil
 }
 
 func (c *localCache) NewGroup(
-	name string, cacheBytes int64, loader cache.LoadFunc,
+	name string, cacheBytes int64, loader cache.LoadFunc, o ...cache.GroupOption,
 ) cache.Group {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	g, ok := c.groups[name]
 	if !ok {
+		opts := cache.BuildGroupOptions(o...)
 		g = &group{
-			lru:  lru.New(cacheBytes),
+			lru:  lru.NewWithPolicy(cacheBytes, opts.Policy()),
 			load: loader,
+			ttl:  opts.TTL,
 		}
+		g.restore(c.restored[name])
+		delete(c.restored, name)
 		c.groups[name] = g
 	}
 	return g
 }
 
+// Close snapshots all groups when snapshots are activated
+func (c *localCache) Close() error {
+	if c.snapshot == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groups := make(map[string][]*entry, len(c.groups))
+	for name, g := range c.groups {
+		groups[name] = g.entries()
+	}
+	return c.snapshot.Save(groups)
+}
+
 type group struct {
 	mu sync.Mutex
 
 	lru  *lru.Cache
 	load cache.LoadFunc
+	ttl  time.Duration
 }
 
 func (g *group) Get(ctx journey.Ctx, key string) ([]byte, error) {
@@ -57,21 +139,79 @@ func (g *group) Get(ctx journey.Ctx, key string) ([]byte, error) {
 
 	v, ok := g.lru.Get(key)
 	if ok {
-		return v.(*vBytes).data, nil
+		b := v.(*vBytes)
+		if !b.expired(time.Now()) {
+			return b.data, nil
+		}
+		g.lru.Delete(key)
 	}
 
 	data, err := g.load(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	g.lru.Set(key, &vBytes{data})
+	b := &vBytes{data: data}
+	if g.ttl > 0 {
+		b.expires = time.Now().Add(g.ttl)
+	}
+	g.lru.Set(key, b)
 	return data, nil
 }
 
+// entries returns all live entries, ordered from the one that would be
+// evicted first to the one that would be evicted last
+func (g *group) entries() []*entry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	items := g.lru.Items()
+	l := make([]*entry, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		b := items[i].Value.(*vBytes)
+		if b.expired(now) {
+			continue
+		}
+		l = append(l, &entry{
+			Key:     items[i].Key,
+			Data:    b.data,
+			Expires: b.expires,
+		})
+	}
+	return l
+}
+
+// restore fills the group with the given entries. Expired entries are
+// skipped and the group capacity is enforced by the eviction policy.
+func (g *group) restore(l []*entry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range l {
+		b := &vBytes{data: e.Data, expires: e.Expires}
+		if g.ttl == 0 {
+			// TTL has been deactivated since the last snapshot
+			b.expires = time.Time{}
+		} else if max := now.Add(g.ttl); b.expires.IsZero() || b.expires.After(max) {
+			b.expires = max
+		}
+		if b.expired(now) {
+			continue
+		}
+		g.lru.Set(e.Key, b)
+	}
+}
+
 type vBytes struct {
-	data []byte
+	data    []byte
+	expires time.Time
 }
 
 func (w *vBytes) Size() int {
 	return len(w.data)
 }
+
+func (w *vBytes) expired(now time.Time) bool {
+	return !w.expires.IsZero() && now.After(w.expires)
+}
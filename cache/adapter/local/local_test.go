@@ -1,14 +1,26 @@
 package local_test
 
 import (
+	"bytes"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/stairlin/lego/cache"
 	"github.com/stairlin/lego/cache/adapter/local"
 	"github.com/stairlin/lego/config"
 	"github.com/stairlin/lego/ctx/journey"
 	lt "github.com/stairlin/lego/testing"
 )
 
+var snapshotConfig = []byte(`
+[cache.local.snapshot]
+	db = "test.db"
+
+[cache.local.snapshot.encryption]
+  default = 0
+  keys = ["HldTqnRguKViCmSQfrHTUk44vOaUCqpsnMZQDNzN7FTNeH0LOgBW2bdbCYANPaKzr+6whIwQ51aSbU9SRfrTfQ=="]`)
+
 func TestCache(t *testing.T) {
 	tt := lt.New(t)
 	app := tt.NewAppCtx("journey-test")
@@ -108,3 +120,95 @@ func TestCache(t *testing.T) {
 		t.Errorf("Expect to load data once, but got %d", load)
 	}
 }
+
+func TestTTL(t *testing.T) {
+	tt := lt.New(t)
+	app := tt.NewAppCtx("journey-test")
+
+	c, err := local.New(config.NullTree(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var load int
+	group := c.NewGroup("foo", 64, func(ctx journey.Ctx, key string) ([]byte, error) {
+		load++
+		return []byte("bar"), nil
+	}, cache.WithTTL(time.Millisecond*10))
+
+	ctx := journey.New(app)
+	group.Get(ctx, "alpha")
+	group.Get(ctx, "alpha")
+	if load != 1 {
+		t.Errorf("expect to load data once, but got %d", load)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	group.Get(ctx, "alpha")
+	if load != 2 {
+		t.Errorf("expect to load expired data again, but got %d loads", load)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tt := lt.New(t)
+	app := tt.NewAppCtx("journey-test")
+
+	configTree, err := config.LoadTree(bytes.NewReader(snapshotConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("test.db")
+
+	var load int
+	loader := func(ctx journey.Ctx, key string) ([]byte, error) {
+		load++
+		return []byte(key), nil
+	}
+
+	// Fill cache and snapshot it
+	c, err := local.New(configTree.Get("cache.local"), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := journey.New(app)
+	group := c.NewGroup("foo", 64, loader)
+	short := c.NewGroup("short", 64, loader, cache.WithTTL(time.Millisecond*10))
+	for _, k := range []string{"alpha", "beta", "gamma"} {
+		group.Get(ctx, k)
+		short.Get(ctx, k)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 20)
+
+	// Restore it with a smaller capacity
+	load = 0
+	c, err = local.New(configTree.Get("cache.local"), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group = c.NewGroup("foo", 9, loader)
+	short = c.NewGroup("short", 64, loader, cache.WithTTL(time.Millisecond*10))
+	for _, k := range []string{"beta", "gamma"} {
+		got, err := group.Get(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != k {
+			t.Errorf("expect to get %s, but got %s", k, string(got))
+		}
+	}
+	if load != 0 {
+		t.Errorf("expect restored entries to be served from cache, but got %d loads", load)
+	}
+	group.Get(ctx, "alpha")
+	if load != 1 {
+		t.Errorf("expect oldest entry to be evicted on restore, but got %d loads", load)
+	}
+	short.Get(ctx, "alpha")
+	if load != 2 {
+		t.Errorf("expect expired entries to be discarded, but got %d loads", load)
+	}
+}
@@ -0,0 +1,171 @@
+package local
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/crypto"
+)
+
+const dbFileMod = 0600
+
+// entry is a snapshotted cache entry
+type entry struct {
+	Key     string
+	Data    []byte
+	Expires time.Time
+}
+
+// snapshot persists group contents to a bolt database. Each group has its
+// own bucket, in which entries are stored by eviction order.
+type snapshot struct {
+	path   string
+	crypto *crypto.Rotor
+}
+
+func newSnapshot(c *SnapshotConfig) (*snapshot, error) {
+	if c.DB == "" {
+		return nil, errors.New("missing cache snapshot db")
+	}
+
+	s := &snapshot{path: c.DB}
+	if c.Encryption != nil {
+		keys := make(map[uint32][]byte)
+		for i, key := range c.Encryption.Keys {
+			decodedKey, err := base64.StdEncoding.DecodeString(key)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot decode snapshot key #%d", i)
+			}
+			if len(decodedKey) != crypto.KeySize {
+				return nil, errors.Errorf(
+					"invalid encryption key length %d != %d", len(decodedKey), crypto.KeySize,
+				)
+			}
+			keys[uint32(i)] = decodedKey
+		}
+		s.crypto = crypto.NewRotor(keys, c.Encryption.Default)
+	}
+	return s, nil
+}
+
+// Load returns all entries by group name
+func (s *snapshot) Load() (map[string][]*entry, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	groups := map[string][]*entry{}
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			var l []*entry
+			err := b.ForEach(func(_, v []byte) error {
+				e := &entry{}
+				if err := s.unmarshal(v, e); err != nil {
+					return errors.Wrapf(err, "cannot decode entry of group <%s>", name)
+				}
+				l = append(l, e)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			groups[string(name)] = l
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Save replaces the snapshot content with the given groups
+func (s *snapshot) Save(groups map[string][]*entry) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		// Drop previous snapshot
+		var names [][]byte
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte(nil), name...))
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "error listing buckets")
+		}
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return errors.Wrapf(err, "error deleting bucket <%s>", name)
+			}
+		}
+
+		for name, l := range groups {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return errors.Wrapf(err, "error creating bucket <%s>", name)
+			}
+			for i, e := range l {
+				data, err := s.marshal(e)
+				if err != nil {
+					return errors.Wrapf(err, "cannot encode entry of group <%s>", name)
+				}
+				if err := b.Put(seqKey(i), data); err != nil {
+					return errors.Wrap(err, "error creating entry record")
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *snapshot) open() (*bolt.DB, error) {
+	db, err := bolt.Open(
+		s.path,
+		dbFileMod,
+		&bolt.Options{Timeout: 1 * time.Second},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening cache snapshot")
+	}
+	return db, nil
+}
+
+func (s *snapshot) marshal(e *entry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return nil, err
+	}
+	if s.crypto == nil {
+		return buf.Bytes(), nil
+	}
+	return s.crypto.Encrypt(buf.Bytes())
+}
+
+func (s *snapshot) unmarshal(data []byte, e *entry) error {
+	if s.crypto != nil {
+		plain, err := s.crypto.Decrypt(data)
+		if err != nil {
+			return err
+		}
+		data = plain
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(e)
+}
+
+// seqKey returns a key which keeps entries sorted by insertion order
+func seqKey(i int) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(i))
+	return k
+}
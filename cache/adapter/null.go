@@ -13,11 +13,15 @@ func newNullCache() cache.Cache {
 }
 
 func (c *nullCache) NewGroup(
-	name string, cacheBytes int64, loader cache.LoadFunc,
+	name string, cacheBytes int64, loader cache.LoadFunc, _ ...cache.GroupOption,
 ) cache.Group {
 	return &group{load: loader}
 }
 
+func (c *nullCache) Close() error {
+	return nil
+}
+
 type group struct {
 	load cache.LoadFunc
 }
@@ -2,14 +2,21 @@
 package cache
 
 import (
+	"time"
+
+	"github.com/stairlin/lego/cache/lru"
 	"github.com/stairlin/lego/ctx/journey"
 	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/log"
 )
 
 type Cache interface {
 	// NewGroup creates a LRU caching namespace with a size limit and a load
 	// function to be called when the value is mising
-	NewGroup(name string, cacheBytes int64, loader LoadFunc) Group
+	NewGroup(name string, cacheBytes int64, loader LoadFunc, o ...GroupOption) Group
+	// Close releases the cache resources. Adapters which persist their content
+	// do it at that point.
+	Close() error
 }
 
 // A Group is a cache namespace
@@ -20,7 +27,52 @@ type Group interface {
 // A LoadFunc loads data for a key.
 type LoadFunc func(context journey.Ctx, key string) ([]byte, error)
 
+// GroupOption configures how we set up a group
+type GroupOption func(*GroupOptions)
+
+// GroupOptions configure a group. GroupOptions are set by the GroupOption
+// values passed to NewGroup.
+type GroupOptions struct {
+	// Policy builds the eviction policy of the group
+	Policy func() lru.Policy
+	// TTL is how long a value is kept before being loaded again (0 = forever)
+	TTL time.Duration
+}
+
+// BuildGroupOptions returns the group options with their default values and
+// the given options applied
+func BuildGroupOptions(o ...GroupOption) GroupOptions {
+	opts := GroupOptions{
+		Policy: lru.NewLRU,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+	return opts
+}
+
+// WithPolicy sets the eviction policy of a group.
+//
+// When omitted from the parameters, the group evicts the least recently used
+// values (lru.NewLRU). Scan-heavy workloads should consider lru.New2Q or
+// lru.NewARC, which are scan-resistant.
+func WithPolicy(p func() lru.Policy) GroupOption {
+	return func(o *GroupOptions) {
+		o.Policy = p
+	}
+}
+
+// WithTTL sets how long a value is kept in a group before being loaded again.
+//
+// When omitted from the parameters, values are kept until they are evicted.
+func WithTTL(d time.Duration) GroupOption {
+	return func(o *GroupOptions) {
+		o.TTL = d
+	}
+}
+
 // Dependencies is an interface to "inject" required services
 type Dependencies interface {
+	L() log.Logger
 	Disco() disco.Agent
 }
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// JSON is a codec that encodes objects with encoding/json
+	JSON Codec = &jsonCodec{}
+	// Gob is a codec that encodes objects with encoding/gob
+	Gob Codec = &gobCodec{}
+	// Proto is a codec that encodes protocol buffer messages
+	Proto Codec = &protoCodec{}
+)
+
+// A Codec encodes objects to bytes and decodes them back
+type Codec interface {
+	// Marshal returns the encoding of v
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal parses the encoded data and stores the result in the value
+	// pointed to by v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (c *jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c *jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (c *gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type protoCodec struct{}
+
+func (c *protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("cache: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (c *protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("cache: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
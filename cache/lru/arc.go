@@ -0,0 +1,116 @@
+package lru
+
+// NewARC returns a policy implementing the Adaptive Replacement Cache
+// algorithm.
+//
+// Keys seen once live in T1 and keys seen at least twice live in T2. Evicted
+// keys are remembered in the ghost lists B1 and B2, which are used to adapt
+// the target size of T1 to the workload (recency vs frequency).
+//
+// Sizes are measured in number of keys, since the policy does not know the
+// size of the values.
+func NewARC() Policy {
+	return &arcPolicy{
+		t1: newKeyList(),
+		t2: newKeyList(),
+		b1: newKeyList(),
+		b2: newKeyList(),
+	}
+}
+
+type arcPolicy struct {
+	// p is the target size of t1
+	p int
+
+	t1 *keyList
+	t2 *keyList
+	b1 *keyList
+	b2 *keyList
+}
+
+func (a *arcPolicy) Add(key string) {
+	switch {
+	case a.t1.Has(key) || a.t2.Has(key):
+		a.Access(key)
+	case a.b1.Has(key):
+		// Recency would have helped, so grow t1
+		a.p = min(a.p+max(a.b2.Len()/max(a.b1.Len(), 1), 1), a.resident()+1)
+		a.b1.Remove(key)
+		a.t2.PushFront(key)
+	case a.b2.Has(key):
+		// Frequency would have helped, so shrink t1
+		a.p = max(a.p-max(a.b1.Len()/max(a.b2.Len(), 1), 1), 0)
+		a.b2.Remove(key)
+		a.t2.PushFront(key)
+	default:
+		a.t1.PushFront(key)
+	}
+}
+
+func (a *arcPolicy) Access(key string) {
+	if a.t1.Remove(key) {
+		a.t2.PushFront(key)
+		return
+	}
+	a.t2.MoveToFront(key)
+}
+
+func (a *arcPolicy) Remove(key string) {
+	if !a.t1.Remove(key) {
+		a.t2.Remove(key)
+	}
+}
+
+func (a *arcPolicy) Evict() (string, bool) {
+	var key string
+	var ok bool
+	if a.t1.Len() > 0 && (a.t1.Len() > a.p || a.t2.Len() == 0) {
+		key, ok = a.t1.PopBack()
+		a.b1.PushFront(key)
+	} else {
+		key, ok = a.t2.PopBack()
+		if ok {
+			a.b2.PushFront(key)
+		}
+	}
+
+	// Ghost lists never remember more keys than the cache holds
+	c := max(a.resident(), 1)
+	for a.b1.Len() > c {
+		a.b1.PopBack()
+	}
+	for a.b1.Len()+a.b2.Len() > 2*c {
+		a.b2.PopBack()
+	}
+	return key, ok
+}
+
+func (a *arcPolicy) Keys() []string {
+	return append(a.t2.Keys(), a.t1.Keys()...)
+}
+
+func (a *arcPolicy) Clear() {
+	a.p = 0
+	a.t1.Clear()
+	a.t2.Clear()
+	a.b1.Clear()
+	a.b2.Clear()
+}
+
+func (a *arcPolicy) resident() int {
+	return a.t1.Len() + a.t2.Len()
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,117 @@
+package lru
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// NewLFU returns a policy that evicts the least frequently used key.
+// Ties are broken by evicting the least recently used key.
+func NewLFU() Policy {
+	return &lfuPolicy{m: make(map[string]*lfuItem)}
+}
+
+type lfuPolicy struct {
+	h    lfuHeap
+	m    map[string]*lfuItem
+	tick uint64
+}
+
+type lfuItem struct {
+	key   string
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+func (p *lfuPolicy) Add(key string) {
+	if _, ok := p.m[key]; ok {
+		p.Access(key)
+		return
+	}
+	p.tick++
+	i := &lfuItem{key: key, freq: 1, tick: p.tick}
+	p.m[key] = i
+	heap.Push(&p.h, i)
+}
+
+func (p *lfuPolicy) Access(key string) {
+	i, ok := p.m[key]
+	if !ok {
+		return
+	}
+	p.tick++
+	i.freq++
+	i.tick = p.tick
+	heap.Fix(&p.h, i.index)
+}
+
+func (p *lfuPolicy) Remove(key string) {
+	i, ok := p.m[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&p.h, i.index)
+	delete(p.m, key)
+}
+
+func (p *lfuPolicy) Evict() (string, bool) {
+	if p.h.Len() == 0 {
+		return "", false
+	}
+	i := heap.Pop(&p.h).(*lfuItem)
+	delete(p.m, i.key)
+	return i.key, true
+}
+
+func (p *lfuPolicy) Keys() []string {
+	items := make(lfuHeap, len(p.h))
+	copy(items, p.h)
+	sort.Slice(items, func(a, b int) bool {
+		return items.Less(b, a)
+	})
+
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.key
+	}
+	return keys
+}
+
+func (p *lfuPolicy) Clear() {
+	p.h = nil
+	p.m = make(map[string]*lfuItem)
+}
+
+// lfuHeap is a min-heap of items ordered by frequency and then by access time
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	i := x.(*lfuItem)
+	i.index = len(*h)
+	*h = append(*h, i)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	i := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return i
+}
@@ -1,5 +1,8 @@
 // Package lru implements a LRU cache.
 //
+// The eviction policy is pluggable, so the cache can also behave like a LFU,
+// 2Q or ARC cache.
+//
 // Source: https://github.com/vitessio/vitess/blob/master/go/cache/lru_cache.go
 package lru
 
@@ -14,12 +17,18 @@ import (
 // reaches the capacity, the least recently used item is deleted from
 // the cache. Note the capacity is not the number of items, but the
 // total sum of the Size() of each item.
+//
+// The eviction order can be changed with NewWithPolicy.
 type Cache struct {
 	mu sync.Mutex
 
-	// list & table contain *entry objects.
-	list  *list.List
-	table map[string]*list.Element
+	// policy elects the entries to evict
+	policy Policy
+	// table contains *entry objects.
+	table map[string]*entry
+	// accessed orders entries from the most recently accessed to the least
+	// recently accessed, regardless of the policy
+	accessed *list.List
 
 	size      int64
 	capacity  int64
@@ -44,13 +53,21 @@ type entry struct {
 	value        Value
 	size         int64
 	timeAccessed time.Time
+	element      *list.Element
 }
 
 // New creates a new empty cache with the given capacity.
 func New(capacity int64) *Cache {
+	return NewWithPolicy(capacity, NewLRU())
+}
+
+// NewWithPolicy creates a new empty cache with the given capacity, which
+// evicts entries elected by the given policy.
+func NewWithPolicy(capacity int64, p Policy) *Cache {
 	return &Cache{
-		list:     list.New(),
-		table:    make(map[string]*list.Element),
+		policy:   p,
+		table:    make(map[string]*entry),
+		accessed: list.New(),
 		capacity: capacity,
 	}
 }
@@ -61,12 +78,12 @@ func (lru *Cache) Get(key string) (v Value, ok bool) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	element := lru.table[key]
-	if element == nil {
+	e := lru.table[key]
+	if e == nil {
 		return nil, false
 	}
-	lru.moveToFront(element)
-	return element.Value.(*entry).value, true
+	lru.access(e)
+	return e.value, true
 }
 
 // Peek returns a value from the cache without changing the LRU order.
@@ -74,11 +91,11 @@ func (lru *Cache) Peek(key string) (v Value, ok bool) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	element := lru.table[key]
-	if element == nil {
+	e := lru.table[key]
+	if e == nil {
 		return nil, false
 	}
-	return element.Value.(*entry).value, true
+	return e.value, true
 }
 
 // Set sets a value in the cache.
@@ -86,8 +103,8 @@ func (lru *Cache) Set(key string, value Value) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	if element := lru.table[key]; element != nil {
-		lru.updateInplace(element, value)
+	if e := lru.table[key]; e != nil {
+		lru.updateInplace(e, value)
 	} else {
 		lru.addNew(key, value)
 	}
@@ -99,8 +116,8 @@ func (lru *Cache) SetIfAbsent(key string, value Value) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	if element := lru.table[key]; element != nil {
-		lru.moveToFront(element)
+	if e := lru.table[key]; e != nil {
+		lru.access(e)
 	} else {
 		lru.addNew(key, value)
 	}
@@ -111,14 +128,15 @@ func (lru *Cache) Delete(key string) bool {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	element := lru.table[key]
-	if element == nil {
+	e := lru.table[key]
+	if e == nil {
 		return false
 	}
 
-	lru.list.Remove(element)
+	lru.policy.Remove(key)
+	lru.accessed.Remove(e.element)
 	delete(lru.table, key)
-	lru.size -= element.Value.(*entry).size
+	lru.size -= e.size
 	return true
 }
 
@@ -127,8 +145,9 @@ func (lru *Cache) Clear() {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	lru.list.Init()
-	lru.table = make(map[string]*list.Element)
+	lru.policy.Clear()
+	lru.table = make(map[string]*entry)
+	lru.accessed.Init()
 	lru.size = 0
 }
 
@@ -147,10 +166,7 @@ func (lru *Cache) SetCapacity(capacity int64) {
 func (lru *Cache) Stats() (length, size, capacity, evictions int64, oldest time.Time) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
-	if lastElem := lru.list.Back(); lastElem != nil {
-		oldest = lastElem.Value.(*entry).timeAccessed
-	}
-	return int64(lru.list.Len()), lru.size, lru.capacity, lru.evictions, oldest
+	return int64(len(lru.table)), lru.size, lru.capacity, lru.evictions, lru.oldest()
 }
 
 // StatsJSON returns stats as a JSON object in a string.
@@ -166,7 +182,7 @@ func (lru *Cache) StatsJSON() string {
 func (lru *Cache) Length() int64 {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
-	return int64(lru.list.Len())
+	return int64(len(lru.table))
 }
 
 // Size returns the sum of the objects' Size() method.
@@ -190,74 +206,85 @@ func (lru *Cache) Evictions() int64 {
 	return lru.evictions
 }
 
-// Oldest returns the insertion time of the oldest element in the cache,
-// or a IsZero() time if cache is empty.
+// Oldest returns the access time of the least recently accessed element
+// in the cache, or a IsZero() time if cache is empty.
 func (lru *Cache) Oldest() (oldest time.Time) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
-	if lastElem := lru.list.Back(); lastElem != nil {
-		oldest = lastElem.Value.(*entry).timeAccessed
-	}
-	return oldest
+	return lru.oldest()
 }
 
-// Keys returns all the keys for the cache, ordered from most recently
-// used to last recently used.
+// Keys returns all the keys for the cache, ordered from the entry the
+// policy will evict last to the one it will evict first. With the default
+// policy, that is from most recently used to last recently used.
 func (lru *Cache) Keys() []string {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	keys := make([]string, 0, lru.list.Len())
-	for e := lru.list.Front(); e != nil; e = e.Next() {
-		keys = append(keys, e.Value.(*entry).key)
-	}
-	return keys
+	return lru.policy.Keys()
 }
 
-// Items returns all the values for the cache, ordered from most recently
-// used to last recently used.
+// Items returns all the values for the cache, ordered like Keys.
 func (lru *Cache) Items() []Item {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	items := make([]Item, 0, lru.list.Len())
-	for e := lru.list.Front(); e != nil; e = e.Next() {
-		v := e.Value.(*entry)
+	keys := lru.policy.Keys()
+	items := make([]Item, 0, len(keys))
+	for _, k := range keys {
+		v := lru.table[k]
 		items = append(items, Item{Key: v.key, Value: v.value})
 	}
 	return items
 }
 
-func (lru *Cache) updateInplace(element *list.Element, value Value) {
+func (lru *Cache) updateInplace(e *entry, value Value) {
 	valueSize := int64(value.Size())
-	sizeDiff := valueSize - element.Value.(*entry).size
-	element.Value.(*entry).value = value
-	element.Value.(*entry).size = valueSize
+	sizeDiff := valueSize - e.size
+	e.value = value
+	e.size = valueSize
 	lru.size += sizeDiff
-	lru.moveToFront(element)
+	lru.access(e)
 	lru.checkCapacity()
 }
 
-func (lru *Cache) moveToFront(element *list.Element) {
-	lru.list.MoveToFront(element)
-	element.Value.(*entry).timeAccessed = time.Now()
+func (lru *Cache) access(e *entry) {
+	lru.policy.Access(e.key)
+	lru.accessed.MoveToFront(e.element)
+	e.timeAccessed = time.Now()
 }
 
 func (lru *Cache) addNew(key string, value Value) {
-	newEntry := &entry{key, value, int64(value.Size()), time.Now()}
-	element := lru.list.PushFront(newEntry)
-	lru.table[key] = element
+	newEntry := &entry{
+		key:          key,
+		value:        value,
+		size:         int64(value.Size()),
+		timeAccessed: time.Now(),
+	}
+	newEntry.element = lru.accessed.PushFront(newEntry)
+	lru.policy.Add(key)
+	lru.table[key] = newEntry
 	lru.size += newEntry.size
 	lru.checkCapacity()
 }
 
+func (lru *Cache) oldest() (oldest time.Time) {
+	if e := lru.accessed.Back(); e != nil {
+		return e.Value.(*entry).timeAccessed
+	}
+	return oldest
+}
+
 func (lru *Cache) checkCapacity() {
 	// Partially duplicated from Delete
 	for lru.size > lru.capacity {
-		delElem := lru.list.Back()
-		delValue := delElem.Value.(*entry)
-		lru.list.Remove(delElem)
-		delete(lru.table, delValue.key)
+		key, ok := lru.policy.Evict()
+		if !ok {
+			return
+		}
+		delValue := lru.table[key]
+		lru.accessed.Remove(delValue.element)
+		delete(lru.table, key)
 		lru.size -= delValue.size
 		lru.evictions++
 	}
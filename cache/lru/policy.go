@@ -0,0 +1,113 @@
+package lru
+
+import "container/list"
+
+// Policy is an eviction policy. It keeps track of the keys held by a cache
+// and elects the ones to evict when the cache exceeds its capacity.
+//
+// A Policy does not need to be thread-safe, since it is always called by
+// the cache while holding its lock.
+type Policy interface {
+	// Add records a new key
+	Add(key string)
+	// Access records a hit on an existing key
+	Access(key string)
+	// Remove forgets a key
+	Remove(key string)
+	// Evict elects a key to evict and forgets it. It returns false when
+	// there is nothing left to evict.
+	Evict() (string, bool)
+	// Keys returns all keys, ordered from the one that would be evicted last
+	// to the one that would be evicted first
+	Keys() []string
+	// Clear forgets all keys
+	Clear()
+}
+
+// NewLRU returns a policy that evicts the least recently used key
+func NewLRU() Policy {
+	return &lruPolicy{l: newKeyList()}
+}
+
+type lruPolicy struct {
+	l *keyList
+}
+
+func (p *lruPolicy) Add(key string)    { p.l.PushFront(key) }
+func (p *lruPolicy) Access(key string) { p.l.MoveToFront(key) }
+func (p *lruPolicy) Remove(key string) { p.l.Remove(key) }
+func (p *lruPolicy) Evict() (string, bool) {
+	return p.l.PopBack()
+}
+func (p *lruPolicy) Keys() []string { return p.l.Keys() }
+func (p *lruPolicy) Clear()         { p.l.Clear() }
+
+// keyList is a list of unique keys with a constant-time lookup
+type keyList struct {
+	l *list.List
+	m map[string]*list.Element
+}
+
+func newKeyList() *keyList {
+	return &keyList{
+		l: list.New(),
+		m: make(map[string]*list.Element),
+	}
+}
+
+func (k *keyList) Len() int {
+	return k.l.Len()
+}
+
+func (k *keyList) Has(key string) bool {
+	_, ok := k.m[key]
+	return ok
+}
+
+func (k *keyList) PushFront(key string) {
+	if e, ok := k.m[key]; ok {
+		k.l.MoveToFront(e)
+		return
+	}
+	k.m[key] = k.l.PushFront(key)
+}
+
+func (k *keyList) MoveToFront(key string) {
+	if e, ok := k.m[key]; ok {
+		k.l.MoveToFront(e)
+	}
+}
+
+func (k *keyList) Remove(key string) bool {
+	e, ok := k.m[key]
+	if !ok {
+		return false
+	}
+	k.l.Remove(e)
+	delete(k.m, key)
+	return true
+}
+
+func (k *keyList) PopBack() (string, bool) {
+	e := k.l.Back()
+	if e == nil {
+		return "", false
+	}
+	key := e.Value.(string)
+	k.l.Remove(e)
+	delete(k.m, key)
+	return key, true
+}
+
+func (k *keyList) Keys() []string {
+	keys := make([]string, 0, k.l.Len())
+	for e := k.l.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	return keys
+}
+
+func (k *keyList) Clear() {
+	k.l.Init()
+	k.m = make(map[string]*list.Element)
+}
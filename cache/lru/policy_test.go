@@ -0,0 +1,187 @@
+package lru_test
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/cache/lru"
+)
+
+var policies = map[string]func() lru.Policy{
+	"lru": lru.NewLRU,
+	"lfu": lru.NewLFU,
+	"2q":  lru.New2Q,
+	"arc": lru.NewARC,
+}
+
+type value int
+
+func (v value) Size() int {
+	return int(v)
+}
+
+func TestLRU(t *testing.T) {
+	c := lru.New(3)
+	c.Set("a", value(1))
+	c.Set("b", value(1))
+	c.Set("c", value(1))
+	c.Get("a")
+	c.Set("d", value(1))
+
+	expect := []string{"d", "a", "c"}
+	if got := c.Keys(); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expect keys to be %v, but got %v", expect, got)
+	}
+	if c.Evictions() != 1 {
+		t.Errorf("expect 1 eviction, but got %d", c.Evictions())
+	}
+}
+
+func TestLFU(t *testing.T) {
+	c := lru.NewWithPolicy(3, lru.NewLFU())
+	c.Set("a", value(1))
+	c.Set("b", value(1))
+	c.Set("c", value(1))
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	c.Set("d", value(1))
+
+	if _, ok := c.Peek("c"); ok {
+		t.Error("expect the least frequently used key to be evicted")
+	}
+	expect := []string{"a", "b", "d"}
+	if got := c.Keys(); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expect keys to be %v, but got %v", expect, got)
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	trace := scanTrace(20000)
+	base := hitRate(lru.NewLRU, 500, trace)
+	for _, name := range []string{"lfu", "2q", "arc"} {
+		if got := hitRate(policies[name], 500, trace); got <= base {
+			t.Errorf("%s: expect hit rate to beat LRU (%.2f), but got %.2f", name, base, got)
+		}
+	}
+}
+
+func TestPolicySizeAccounting(t *testing.T) {
+	for name, p := range policies {
+		c := lru.NewWithPolicy(10, p())
+		for i := 0; i < 100; i++ {
+			k := strconv.Itoa(i % 17)
+			if _, ok := c.Get(k); !ok {
+				c.Set(k, value(1+i%3))
+			}
+			if c.Size() > c.Capacity() {
+				t.Fatalf("%s: size %d exceeds capacity %d", name, c.Size(), c.Capacity())
+			}
+		}
+		if int64(len(c.Keys())) != c.Length() {
+			t.Errorf("%s: expect %d keys, but got %d", name, c.Length(), len(c.Keys()))
+		}
+
+		c.Clear()
+		if c.Length() != 0 || c.Size() != 0 || len(c.Keys()) != 0 {
+			t.Errorf("%s: expect cache to be empty after Clear", name)
+		}
+	}
+}
+
+func TestPolicyOldest(t *testing.T) {
+	for name, p := range policies {
+		c := lru.NewWithPolicy(10, p())
+		c.Set("a", value(1))
+		time.Sleep(time.Millisecond)
+		mid := time.Now()
+		c.Set("b", value(1))
+		if !c.Oldest().Before(mid) {
+			t.Errorf("%s: expect a to be the least recently accessed entry", name)
+		}
+
+		c.Get("a")
+		if c.Oldest().Before(mid) {
+			t.Errorf("%s: expect b to be the least recently accessed entry", name)
+		}
+		c.Delete("b")
+		if c.Oldest().Before(mid) {
+			t.Errorf("%s: expect a to be the only entry", name)
+		}
+
+		c.Clear()
+		if !c.Oldest().IsZero() {
+			t.Errorf("%s: expect no oldest entry once cleared", name)
+		}
+	}
+}
+
+// Benchmarks compare the hit rate of each policy on synthetic traces.
+// Run them with `go test -bench Trace -benchtime 1x ./cache/lru`
+
+func BenchmarkTraceZipf(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.1, 1, 10000)
+	trace := make([]string, 200000)
+	for i := range trace {
+		trace[i] = strconv.FormatUint(z.Uint64(), 10)
+	}
+	benchmarkTrace(b, 500, trace)
+}
+
+func BenchmarkTraceScan(b *testing.B) {
+	benchmarkTrace(b, 500, scanTrace(200000))
+}
+
+func BenchmarkTraceLoop(b *testing.B) {
+	// A loop slightly larger than the cache capacity is the worst case for LRU
+	trace := make([]string, 200000)
+	for i := range trace {
+		trace[i] = strconv.Itoa(i % 600)
+	}
+	benchmarkTrace(b, 500, trace)
+}
+
+func benchmarkTrace(b *testing.B, capacity int64, trace []string) {
+	for name, p := range policies {
+		b.Run(name, func(b *testing.B) {
+			var rate float64
+			for i := 0; i < b.N; i++ {
+				rate = hitRate(p, capacity, trace)
+			}
+			b.ReportMetric(rate, "hit%")
+		})
+	}
+}
+
+// scanTrace returns a trace where 90% of the traffic targets a small hot set,
+// while the rest is a sequential scan over a large key space
+func scanTrace(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	trace := make([]string, n)
+	for i := range trace {
+		if r.Intn(10) > 0 {
+			trace[i] = "hot" + strconv.Itoa(r.Intn(400))
+		} else {
+			trace[i] = "scan" + strconv.Itoa(i)
+		}
+	}
+	return trace
+}
+
+// hitRate replays trace on a cache and returns the percentage of hits
+func hitRate(p func() lru.Policy, capacity int64, trace []string) float64 {
+	var hits int
+	c := lru.NewWithPolicy(capacity, p())
+	for _, k := range trace {
+		if _, ok := c.Get(k); ok {
+			hits++
+			continue
+		}
+		c.Set(k, value(1))
+	}
+	return float64(hits) * 100 / float64(len(trace))
+}
@@ -0,0 +1,79 @@
+package lru
+
+const (
+	// twoQIn is the share (in %) of resident keys kept in the A1in queue
+	twoQIn = 25
+	// twoQOut is the share (in %) of resident keys remembered by the A1out queue
+	twoQOut = 50
+)
+
+// New2Q returns a policy implementing the 2Q algorithm (full version).
+//
+// New keys enter a FIFO queue (A1in). Keys evicted from it are remembered
+// in a ghost queue (A1out), and are only promoted to the main LRU queue (Am)
+// when they are added again while still being remembered. A scan therefore
+// only washes out A1in, while hot keys stay in Am.
+//
+// Sizes are measured in number of keys, since the policy does not know the
+// size of the values.
+func New2Q() Policy {
+	return &twoQPolicy{
+		in:  newKeyList(),
+		out: newKeyList(),
+		m:   newKeyList(),
+	}
+}
+
+type twoQPolicy struct {
+	in  *keyList
+	out *keyList
+	m   *keyList
+}
+
+func (p *twoQPolicy) Add(key string) {
+	if p.in.Has(key) || p.m.Has(key) {
+		p.Access(key)
+		return
+	}
+	if p.out.Remove(key) {
+		p.m.PushFront(key)
+		return
+	}
+	p.in.PushFront(key)
+}
+
+func (p *twoQPolicy) Access(key string) {
+	// Keys in A1in are not promoted on access, because correlated references
+	// should not be mistaken for hot keys
+	p.m.MoveToFront(key)
+}
+
+func (p *twoQPolicy) Remove(key string) {
+	if !p.in.Remove(key) {
+		p.m.Remove(key)
+	}
+}
+
+func (p *twoQPolicy) Evict() (string, bool) {
+	resident := p.in.Len() + p.m.Len()
+	if p.in.Len() > 0 && (p.in.Len()*100 > resident*twoQIn || p.m.Len() == 0) {
+		key, _ := p.in.PopBack()
+		p.out.PushFront(key)
+		for p.out.Len()*100 > (resident-1)*twoQOut && p.out.Len() > 1 {
+			p.out.PopBack()
+		}
+		return key, true
+	}
+	return p.m.PopBack()
+}
+
+func (p *twoQPolicy) Keys() []string {
+	// Am is evicted once A1in is small enough
+	return append(p.m.Keys(), p.in.Keys()...)
+}
+
+func (p *twoQPolicy) Clear() {
+	p.in.Clear()
+	p.out.Clear()
+	p.m.Clear()
+}
@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/cache/lru"
+	"github.com/stairlin/lego/ctx/journey"
+)
+
+// An ObjectGroup is a cache namespace which holds objects encoded with a codec
+type ObjectGroup interface {
+	// Get stores the object for key in the value pointed to by v
+	Get(ctx journey.Ctx, key string, v interface{}) error
+}
+
+// An ObjectLoadFunc loads an object for a key.
+type ObjectLoadFunc func(context journey.Ctx, key string) (interface{}, error)
+
+// ObjectOption configures how we set up an object group
+type ObjectOption func(*ObjectOptions)
+
+// ObjectOptions configure an object group. ObjectOptions are set by the
+// ObjectOption values passed to NewObjectGroup.
+type ObjectOptions struct {
+	Decoded bool
+	Group   []GroupOption
+}
+
+// WithDecoded keeps decoded objects in a local LRU, so that hits do not pay
+// the decoding cost. The size of each object is the length of its encoding.
+//
+// Decoded objects are shared between callers, which means that reference
+// types (slices, maps, pointers) held by an object must not be mutated. They
+// are not persisted by caches which snapshot their groups.
+func WithDecoded() ObjectOption {
+	return func(o *ObjectOptions) {
+		o.Decoded = true
+	}
+}
+
+// WithGroupOptions sets the options of the underlying group, such as its
+// eviction policy.
+func WithGroupOptions(o ...GroupOption) ObjectOption {
+	return func(opts *ObjectOptions) {
+		opts.Group = append(opts.Group, o...)
+	}
+}
+
+// NewObjectGroup creates a caching namespace on c with a size limit and a load
+// function to be called when the object is missing. Objects returned by the
+// loader are encoded with codec before being stored.
+func NewObjectGroup(
+	c Cache,
+	name string,
+	cacheBytes int64,
+	codec Codec,
+	loader ObjectLoadFunc,
+	o ...ObjectOption,
+) ObjectGroup {
+	opts := ObjectOptions{}
+	for _, o := range o {
+		o(&opts)
+	}
+
+	g := &objectGroup{codec: codec}
+	if opts.Decoded {
+		// Encoded values are not retained by the byte group, because decoded
+		// objects already account for them
+		gopts := BuildGroupOptions(opts.Group...)
+		g.lru = lru.NewWithPolicy(cacheBytes, gopts.Policy())
+		g.ttl = gopts.TTL
+		cacheBytes = 0
+	}
+	g.bytes = c.NewGroup(name, cacheBytes, func(
+		ctx journey.Ctx, key string,
+	) ([]byte, error) {
+		v, err := loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(v)
+	}, opts.Group...)
+	return g
+}
+
+// objectGroup relies on the lru cache lock, so that loads do not block hits
+type objectGroup struct {
+	codec Codec
+	bytes Group
+	lru   *lru.Cache
+	ttl   time.Duration
+}
+
+func (g *objectGroup) Get(ctx journey.Ctx, key string, v interface{}) error {
+	if g.lru == nil {
+		return g.decode(ctx, key, v)
+	}
+
+	if o, ok := g.lru.Get(key); ok {
+		o := o.(*vObject)
+		if !o.expired(time.Now()) {
+			return assign(v, o.v)
+		}
+		g.lru.Delete(key)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("cache: non-pointer destination %T", v)
+	}
+	o := &vObject{v: reflect.New(rv.Type().Elem()).Interface()}
+	data, err := g.bytes.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := g.codec.Unmarshal(data, o.v); err != nil {
+		return errors.Wrap(err, "cache: cannot decode object")
+	}
+	o.size = len(data)
+	if g.ttl > 0 {
+		o.expires = time.Now().Add(g.ttl)
+	}
+	g.lru.Set(key, o)
+	return assign(v, o.v)
+}
+
+func (g *objectGroup) decode(ctx journey.Ctx, key string, v interface{}) error {
+	data, err := g.bytes.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := g.codec.Unmarshal(data, v); err != nil {
+		return errors.Wrap(err, "cache: cannot decode object")
+	}
+	return nil
+}
+
+// assign stores the object pointed to by src in the value pointed to by dst
+func assign(dst, src interface{}) error {
+	d := reflect.ValueOf(dst)
+	s := reflect.ValueOf(src)
+	if d.Kind() != reflect.Ptr || d.IsNil() {
+		return errors.Errorf("cache: non-pointer destination %T", dst)
+	}
+	if d.Type() != s.Type() {
+		return errors.Errorf("cache: cannot assign %T to %T", src, dst)
+	}
+	d.Elem().Set(s.Elem())
+	return nil
+}
+
+type vObject struct {
+	v       interface{}
+	size    int
+	expires time.Time
+}
+
+func (o *vObject) Size() int {
+	return o.size
+}
+
+func (o *vObject) expired(now time.Time) bool {
+	return !o.expires.IsZero() && now.After(o.expires)
+}
@@ -0,0 +1,119 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/cache"
+	"github.com/stairlin/lego/cache/adapter/local"
+	"github.com/stairlin/lego/config"
+	"github.com/stairlin/lego/ctx/journey"
+	lt "github.com/stairlin/lego/testing"
+)
+
+type user struct {
+	ID   string
+	Name string
+}
+
+func TestObjectGroup(t *testing.T) {
+	codecs := map[string]cache.Codec{
+		"json": cache.JSON,
+		"gob":  cache.Gob,
+	}
+
+	for name, codec := range codecs {
+		for _, decoded := range []bool{false, true} {
+			tt := lt.New(t)
+			app := tt.NewAppCtx("object-test")
+
+			c, err := local.New(config.NullTree(), app)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var opts []cache.ObjectOption
+			if decoded {
+				opts = append(opts, cache.WithDecoded())
+			}
+			var load int
+			group := cache.NewObjectGroup(c, name, 1<<10, codec,
+				func(ctx journey.Ctx, key string) (interface{}, error) {
+					load++
+					return &user{ID: key, Name: "Ada"}, nil
+				},
+				opts...,
+			)
+
+			ctx := journey.New(app)
+			for i := 0; i < 2; i++ {
+				var got user
+				if err := group.Get(ctx, "alpha", &got); err != nil {
+					t.Fatal(err)
+				}
+				if got.ID != "alpha" || got.Name != "Ada" {
+					t.Errorf("%s/%v: unexpected object %+v", name, decoded, got)
+				}
+			}
+			if load != 1 {
+				t.Errorf("%s/%v: expect to load data once, but got %d", name, decoded, load)
+			}
+
+			if err := group.Get(ctx, "alpha", user{}); err == nil {
+				t.Errorf("%s/%v: expect an error with a non-pointer value", name, decoded)
+			}
+		}
+	}
+}
+
+// TestObjectGroupConcurrency tests whether a slow load does not block hits on
+// other keys of a decoded group
+func TestObjectGroupConcurrency(t *testing.T) {
+	tt := lt.New(t)
+	app := tt.NewAppCtx("object-test")
+
+	c, err := local.New(config.NullTree(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	group := cache.NewObjectGroup(c, "concurrency", 1<<10, cache.JSON,
+		func(ctx journey.Ctx, key string) (interface{}, error) {
+			if key == "slow" {
+				close(loading)
+				<-release
+			}
+			return &user{ID: key}, nil
+		},
+		cache.WithDecoded(),
+	)
+
+	ctx := journey.New(app)
+	var got user
+	if err := group.Get(ctx, "fast", &got); err != nil {
+		t.Fatal(err)
+	}
+	slow := make(chan error, 1)
+	go func() {
+		var u user
+		slow <- group.Get(ctx, "slow", &u)
+	}()
+	<-loading
+
+	hit := make(chan error, 1)
+	go func() { hit <- group.Get(ctx, "fast", &got) }()
+	select {
+	case err := <-hit:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expect a hit not to wait for a load in progress")
+	}
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,319 @@
+package circuit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/stairlin/lego/log"
+	"github.com/stairlin/lego/stats"
+)
+
+// State is the state of a circuit
+type State uint8
+
+const (
+	// Closed lets all calls through
+	Closed State = iota
+	// Open rejects all calls
+	Open
+	// HalfOpen lets a single probe through
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// outcome is the result of a call
+type outcome uint8
+
+const (
+	success outcome = iota
+	failure
+	// ignored is the outcome of calls cancelled by the caller
+	ignored
+)
+
+// Breaker is a circuit breaker
+type Breaker struct {
+	mu sync.Mutex
+
+	name    string
+	opts    Options
+	service string
+	log     log.Logger
+	stats   stats.Stats
+
+	state    State
+	openedAt time.Time
+	probing  bool
+	running  int
+	buckets  []bucket
+}
+
+// bucket counts the calls which ended within a second
+type bucket struct {
+	sec      int64
+	success  int
+	failures int
+}
+
+func newBreaker(
+	name string, opts Options, service string, log log.Logger, stats stats.Stats,
+) *Breaker {
+	n := int(opts.Window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return &Breaker{
+		name:    name,
+		opts:    opts,
+		service: service,
+		log:     log,
+		stats:   stats,
+		buckets: make([]bucket, n),
+	}
+}
+
+// Name returns the name of the breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state of the circuit
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.opts.SleepWindow {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Do runs f with the breaker timeout. When the call is rejected or fails,
+// fallback is called with the error, and its result is returned. A nil
+// fallback returns the error as is.
+//
+// f should return as soon as its context is done. It keeps its place in the
+// bulkhead until it returns, even when it has timed out.
+func (b *Breaker) Do(
+	ctx context.Context,
+	f func(context.Context) error,
+	fallback func(error) error,
+) error {
+	probe, err := b.acquire()
+	if err != nil {
+		return b.fallback(fallback, err)
+	}
+
+	c, cancel := ctx, func() {}
+	if b.opts.Timeout > 0 {
+		c, cancel = context.WithTimeout(ctx, b.opts.Timeout)
+	}
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		defer b.release()
+		errc <- f(c)
+	}()
+
+	select {
+	case err = <-errc:
+	case <-c.Done():
+		err = c.Err()
+	}
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		err = ErrTimeout
+	}
+
+	switch {
+	case err == nil:
+		b.record(probe, success)
+	case err == ctx.Err():
+		b.record(probe, ignored)
+	default:
+		b.record(probe, failure)
+	}
+	if err != nil {
+		return b.fallback(fallback, err)
+	}
+	return nil
+}
+
+// Allow reserves a place for a call which is run by the caller. It returns
+// ErrOpen when the circuit is open and ErrMaxConcurrency when the bulkhead
+// is full. Otherwise, done must be called once with the outcome of the call.
+func (b *Breaker) Allow() (done func(ok bool), err error) {
+	probe, err := b.acquire()
+	if err != nil {
+		return nil, err
+	}
+	return func(ok bool) {
+		b.release()
+		if ok {
+			b.record(probe, success)
+		} else {
+			b.record(probe, failure)
+		}
+	}, nil
+}
+
+// acquire reserves a place for a call. It tells whether the call is the
+// probe of a half-open circuit.
+func (b *Breaker) acquire() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.opts.SleepWindow {
+		b.setState(HalfOpen)
+	}
+	switch b.state {
+	case Open:
+		b.inc("open")
+		return false, ErrOpen
+	case HalfOpen:
+		if b.probing {
+			b.inc("open")
+			return false, ErrOpen
+		}
+		probe = true
+	}
+
+	if b.opts.MaxConcurrency > 0 && b.running >= b.opts.MaxConcurrency {
+		b.inc("full")
+		return false, ErrMaxConcurrency
+	}
+	b.probing = b.probing || probe
+	b.running++
+	b.stats.Gauge("circuit.running", b.running, b.tags())
+	return probe, nil
+}
+
+// release frees the place used by a call
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.running--
+	b.stats.Gauge("circuit.running", b.running, b.tags())
+}
+
+// record counts the outcome of a call and updates the state of the circuit
+func (b *Breaker) record(probe bool, o outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch o {
+	case success:
+		b.inc("success")
+	case failure:
+		b.inc("failure")
+	}
+
+	if probe {
+		b.probing = false
+		switch o {
+		case success:
+			b.reset()
+			b.setState(Closed)
+		case failure:
+			b.openedAt = time.Now()
+			b.setState(Open)
+		}
+		return
+	}
+	if b.state != Closed || o == ignored {
+		return
+	}
+
+	now := time.Now().Unix()
+	bu := &b.buckets[now%int64(len(b.buckets))]
+	if bu.sec != now {
+		*bu = bucket{sec: now}
+	}
+	if o == success {
+		bu.success++
+	} else {
+		bu.failures++
+	}
+
+	total, failures := b.counts(now)
+	if total >= b.opts.VolumeThreshold &&
+		failures*100 >= b.opts.ErrorThreshold*total {
+		b.openedAt = time.Now()
+		b.setState(Open)
+	}
+}
+
+// counts returns the number of calls and failures within the window
+func (b *Breaker) counts(now int64) (total, failures int) {
+	for _, bu := range b.buckets {
+		if now-bu.sec < int64(len(b.buckets)) {
+			total += bu.success + bu.failures
+			failures += bu.failures
+		}
+	}
+	return total, failures
+}
+
+func (b *Breaker) reset() {
+	for i := range b.buckets {
+		b.buckets[i] = bucket{}
+	}
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state == s {
+		return
+	}
+	from := b.state
+	b.state = s
+	b.stats.Gauge("circuit.state", int(s), b.tags())
+
+	fields := []log.Field{
+		log.String("name", b.name),
+		log.Stringer("from", from),
+		log.Stringer("to", s),
+	}
+	if s == Open {
+		total, failures := b.counts(time.Now().Unix())
+		fields = append(fields,
+			log.Int("calls", total),
+			log.Int("failures", failures),
+		)
+		b.log.Warning("circuit.open", "Circuit opened", fields...)
+		return
+	}
+	b.log.Trace("circuit.state", "Circuit state changed", fields...)
+}
+
+func (b *Breaker) fallback(f func(error) error, err error) error {
+	if f == nil {
+		return err
+	}
+	return f(err)
+}
+
+func (b *Breaker) inc(result string) {
+	tags := b.tags()
+	tags["result"] = result
+	b.stats.Inc("circuit.calls", tags)
+}
+
+func (b *Breaker) tags() map[string]string {
+	return map[string]string{
+		"service": b.service,
+		"name":    b.name,
+	}
+}
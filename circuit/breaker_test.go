@@ -0,0 +1,168 @@
+package circuit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/circuit"
+	lt "github.com/stairlin/lego/testing"
+)
+
+var errFailed = errors.New("failed")
+
+// TestOpenAndClose tests whether a circuit opens above the error threshold,
+// and closes after a successful probe
+func TestOpenAndClose(t *testing.T) {
+	tt := lt.New(t)
+	reg := circuit.NewReg("TestOpenAndClose", tt.Logger(), tt.Stats())
+	err := reg.Configure("c",
+		circuit.WithVolumeThreshold(4),
+		circuit.WithErrorThreshold(50),
+		circuit.WithSleepWindow(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal("expect to be able to configure breaker", err)
+	}
+	b := reg.Get("c")
+
+	results := []error{nil, errFailed, nil, errFailed}
+	for _, res := range results {
+		res := res
+		err := b.Do(context.Background(), func(context.Context) error {
+			return res
+		}, nil)
+		if err != res {
+			t.Errorf("expect %v, but got %v", res, err)
+		}
+	}
+	if b.State() != circuit.Open {
+		t.Fatalf("expect circuit to be open, but got %s", b.State())
+	}
+
+	var called bool
+	err = b.Do(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	}, func(err error) error {
+		if err != circuit.ErrOpen {
+			t.Errorf("expect fallback to receive ErrOpen, but got %v", err)
+		}
+		return nil
+	})
+	if err != nil || called {
+		t.Errorf("expect call to be handled by the fallback (%v, %v)", err, called)
+	}
+
+	// A failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if b.State() != circuit.HalfOpen {
+		t.Fatalf("expect circuit to be half-open, but got %s", b.State())
+	}
+	b.Do(context.Background(), func(context.Context) error {
+		return errFailed
+	}, nil)
+	if b.State() != circuit.Open {
+		t.Fatalf("expect circuit to be open again, but got %s", b.State())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	err = b.Do(context.Background(), func(context.Context) error {
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal("expect probe to succeed", err)
+	}
+	if b.State() != circuit.Closed {
+		t.Errorf("expect circuit to be closed, but got %s", b.State())
+	}
+}
+
+// TestSingleProbe tests whether a half-open circuit lets a single call through
+func TestSingleProbe(t *testing.T) {
+	tt := lt.New(t)
+	reg := circuit.NewReg("TestSingleProbe", tt.Logger(), tt.Stats())
+	reg.Configure("c",
+		circuit.WithVolumeThreshold(1),
+		circuit.WithSleepWindow(time.Millisecond),
+	)
+	b := reg.Get("c")
+	b.Do(context.Background(), func(context.Context) error {
+		return errFailed
+	}, nil)
+	time.Sleep(2 * time.Millisecond)
+
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatal("expect probe to be allowed", err)
+	}
+	if _, err := b.Allow(); err != circuit.ErrOpen {
+		t.Errorf("expect ErrOpen during the probe, but got %v", err)
+	}
+	done(true)
+	if b.State() != circuit.Closed {
+		t.Errorf("expect circuit to be closed, but got %s", b.State())
+	}
+}
+
+// TestTimeout tests whether a call is abandoned after the breaker timeout
+func TestTimeout(t *testing.T) {
+	tt := lt.New(t)
+	reg := circuit.NewReg("TestTimeout", tt.Logger(), tt.Stats())
+	reg.Configure("c", circuit.WithTimeout(10*time.Millisecond))
+
+	err := reg.Get("c").Do(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+	if err != circuit.ErrTimeout {
+		t.Errorf("expect ErrTimeout, but got %v", err)
+	}
+}
+
+// TestMaxConcurrency tests whether a breaker rejects calls when its bulkhead
+// is full
+func TestMaxConcurrency(t *testing.T) {
+	tt := lt.New(t)
+	reg := circuit.NewReg("TestMaxConcurrency", tt.Logger(), tt.Stats())
+	reg.Configure("c", circuit.WithMaxConcurrency(2))
+	b := reg.Get("c")
+
+	release := make(chan struct{})
+	started := sync.WaitGroup{}
+	finished := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		started.Add(1)
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			b.Do(context.Background(), func(context.Context) error {
+				started.Done()
+				<-release
+				return nil
+			}, nil)
+		}()
+	}
+	started.Wait()
+
+	err := b.Do(context.Background(), func(context.Context) error {
+		return nil
+	}, nil)
+	if err != circuit.ErrMaxConcurrency {
+		t.Errorf("expect ErrMaxConcurrency, but got %v", err)
+	}
+	close(release)
+	finished.Wait()
+}
+
+// TestConfigure tests whether a breaker cannot be configured twice
+func TestConfigure(t *testing.T) {
+	tt := lt.New(t)
+	reg := circuit.NewReg("TestConfigure", tt.Logger(), tt.Stats())
+	reg.Get("c")
+	if err := reg.Configure("c"); err != circuit.ErrDupBreaker {
+		t.Errorf("expect ErrDupBreaker, but got %v", err)
+	}
+}
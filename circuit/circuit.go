@@ -0,0 +1,181 @@
+package circuit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/stairlin/lego/log"
+	"github.com/stairlin/lego/stats"
+)
+
+const (
+	// DefaultTimeout is the default time after which a call is abandoned
+	DefaultTimeout = time.Second
+	// DefaultMaxConcurrency is the default number of calls which can run
+	// concurrently
+	DefaultMaxConcurrency = 10
+	// DefaultErrorThreshold is the default percentage of failed calls from
+	// which the circuit opens
+	DefaultErrorThreshold = 50
+	// DefaultVolumeThreshold is the default minimum number of calls within
+	// the window before the circuit can open
+	DefaultVolumeThreshold = 20
+	// DefaultSleepWindow is the default time during which an open circuit
+	// rejects calls before letting a probe through
+	DefaultSleepWindow = 5 * time.Second
+	// DefaultWindow is the default duration of the rolling window
+	DefaultWindow = 10 * time.Second
+)
+
+var (
+	// ErrOpen is the error returned when a call is rejected by an open circuit
+	ErrOpen = errors.New("circuit is open")
+	// ErrMaxConcurrency is the error returned when a call is rejected because
+	// too many calls are already running
+	ErrMaxConcurrency = errors.New("circuit has reached its max concurrency")
+	// ErrTimeout is the error returned when a call times out
+	ErrTimeout = errors.New("circuit call timeout")
+	// ErrDupBreaker is the error returned when a breaker has already been
+	// configured or used
+	ErrDupBreaker = errors.New("breaker has already been added")
+)
+
+// Option configures how we set up a breaker
+type Option func(*Options)
+
+// Options configure a breaker. Options are set by the Option values passed
+// to Configure.
+type Options struct {
+	Timeout         time.Duration
+	MaxConcurrency  int
+	ErrorThreshold  int
+	VolumeThreshold int
+	SleepWindow     time.Duration
+	Window          time.Duration
+}
+
+// WithTimeout sets the time after which a call is abandoned. A zero timeout
+// disables it.
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// WithMaxConcurrency sets how many calls can run concurrently
+func WithMaxConcurrency(n int) Option {
+	return func(o *Options) {
+		o.MaxConcurrency = n
+	}
+}
+
+// WithErrorThreshold sets the percentage of failed calls from which the
+// circuit opens
+func WithErrorThreshold(percent int) Option {
+	return func(o *Options) {
+		o.ErrorThreshold = percent
+	}
+}
+
+// WithVolumeThreshold sets the minimum number of calls within the window
+// before the circuit can open
+func WithVolumeThreshold(n int) Option {
+	return func(o *Options) {
+		o.VolumeThreshold = n
+	}
+}
+
+// WithSleepWindow sets how long an open circuit rejects calls before letting
+// a probe through
+func WithSleepWindow(d time.Duration) Option {
+	return func(o *Options) {
+		o.SleepWindow = d
+	}
+}
+
+// WithWindow sets the duration of the rolling window in which calls are
+// counted. It is rounded to the second.
+func WithWindow(d time.Duration) Option {
+	return func(o *Options) {
+		o.Window = d
+	}
+}
+
+// Reg is a registry of circuit breakers
+type Reg struct {
+	mu sync.Mutex
+
+	service  string
+	log      log.Logger
+	stats    stats.Stats
+	breakers map[string]*Breaker
+}
+
+// NewReg creates a new breaker registry
+func NewReg(service string, log log.Logger, stats stats.Stats) *Reg {
+	return &Reg{
+		service:  service,
+		log:      log,
+		stats:    stats,
+		breakers: map[string]*Breaker{},
+	}
+}
+
+// Configure adds a breaker with the given options. It must be called before
+// the breaker is used, otherwise it returns ErrDupBreaker.
+func (r *Reg) Configure(name string, o ...Option) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.breakers[name]; ok {
+		return ErrDupBreaker
+	}
+	r.breakers[name] = r.newBreaker(name, o...)
+	return nil
+}
+
+// Get returns the breaker with the given name. A breaker with the default
+// options is added when it has not been configured.
+func (r *Reg) Get(name string) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[name]
+	if !ok {
+		b = r.newBreaker(name)
+		r.breakers[name] = b
+	}
+	return b
+}
+
+// States returns the state of each breaker
+func (r *Reg) States() map[string]State {
+	r.mu.Lock()
+	l := make([]*Breaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		l = append(l, b)
+	}
+	r.mu.Unlock()
+
+	states := make(map[string]State, len(l))
+	for _, b := range l {
+		states[b.name] = b.State()
+	}
+	return states
+}
+
+func (r *Reg) newBreaker(name string, o ...Option) *Breaker {
+	opts := Options{
+		Timeout:         DefaultTimeout,
+		MaxConcurrency:  DefaultMaxConcurrency,
+		ErrorThreshold:  DefaultErrorThreshold,
+		VolumeThreshold: DefaultVolumeThreshold,
+		SleepWindow:     DefaultSleepWindow,
+		Window:          DefaultWindow,
+	}
+	for _, f := range o {
+		f(&opts)
+	}
+	return newBreaker(name, opts, r.service, r.log, r.stats)
+}
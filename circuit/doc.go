@@ -0,0 +1,24 @@
+// Package circuit protects an application from its failing dependencies with
+// circuit breakers.
+//
+// A breaker runs named commands with a timeout and a maximum number of
+// concurrent calls (bulkhead). When the percentage of failed calls within the
+// rolling window goes above a threshold, the circuit opens and calls fail
+// fast. After a sleep window, a single probe is let through (half-open): the
+// circuit closes when it succeeds, and opens again otherwise.
+//
+// A fallback function can be given to handle the failures, including the
+// calls rejected by an open circuit or a full bulkhead.
+//
+// Breakers are held by a registry, which is available from the app context:
+//
+//	appCtx.Circuit().Configure("payments", circuit.WithTimeout(time.Second))
+//
+//	err := ctx.Do("payments", func(ctx journey.Ctx) error {
+//	  // talk to other services
+//	  return nil
+//	}, func(err error) error {
+//	  // do this when services are down
+//	  return nil
+//	})
+package circuit
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/stairlin/lego/bg"
+	"github.com/stairlin/lego/circuit"
 	"github.com/stairlin/lego/config"
 	"github.com/stairlin/lego/ctx"
 	"github.com/stairlin/lego/disco"
@@ -25,6 +26,7 @@ type Ctx interface {
 	L() log.Logger
 	Config() *config.Config
 	BG() *bg.Reg
+	Circuit() *circuit.Reg
 	Disco() disco.Agent
 	Drain()
 	Cancel()
@@ -34,6 +36,7 @@ type Ctx interface {
 type context struct {
 	appConfig  *config.Config
 	bgReg      *bg.Reg
+	circuitReg *circuit.Reg
 	disco      disco.Agent
 	c          goc.Context
 	cancelFunc goc.CancelFunc
@@ -66,6 +69,7 @@ func NewCtx(
 		service:    service,
 		appConfig:  c,
 		bgReg:      reg,
+		circuitReg: circuit.NewReg(service, l, s),
 		disco:      sd,
 		c:          ctx,
 		cancelFunc: cancelFunc,
@@ -95,6 +99,10 @@ func (c *context) BG() *bg.Reg {
 	return c.bgReg
 }
 
+func (c *context) Circuit() *circuit.Reg {
+	return c.circuitReg
+}
+
 func (c *context) Disco() disco.Agent {
 	return c.disco
 }
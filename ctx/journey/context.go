@@ -36,8 +36,10 @@ type Ctx interface {
 	UUID() string
 	ShortID() string
 	AppConfig() *config.Config
-	BG(f func(c Ctx)) error
+	BG(f func(c Ctx), o ...bg.DispatchOption) error
 	BranchOff(t Type) Ctx
+	Do(name string, f func(c Ctx) error, fallback func(err error) error) error
+	Go(name string, f func(c Ctx) error, fallback func(err error) error) <-chan error
 	Cancel()
 	End()
 
@@ -60,8 +62,26 @@ type context struct {
 	KV      *KV
 }
 
+// Option configures how a context is created
+type Option func(*Options)
+
+// Options configure a context. Options are set by the Option values passed
+// to New.
+type Options struct {
+	// NoTimeout tells whether the request timeout is disabled
+	NoTimeout bool
+}
+
+// WithoutTimeout creates a context which is not cancelled after the request
+// timeout, such as the context of a long-lived stream
+func WithoutTimeout() Option {
+	return func(o *Options) {
+		o.NoTimeout = true
+	}
+}
+
 // New creates a new context and returns it
-func New(ctx app.Ctx) Ctx {
+func New(ctx app.Ctx, o ...Option) Ctx {
 	id := uuid.New().String()
 
 	// Log to correlate this journey with the current app environment
@@ -69,7 +89,7 @@ func New(ctx app.Ctx) Ctx {
 		log.String("id", id),
 	)
 
-	c := build(ctx)
+	c := build(ctx, o...)
 	c.Type = Root
 	c.ID = id
 	c.Stepper = NewStepper()
@@ -86,8 +106,9 @@ func (c *context) Stats() stats.Stats {
 	return c.app.Stats()
 }
 
-// BG executes the given function in background
-func (c *context) BG(f func(Ctx)) error {
+// BG executes the given function in background.
+// Options can be given to run it on a pool (e.g. bg.InPool("map.update"))
+func (c *context) BG(f func(Ctx), o ...bg.DispatchOption) error {
 	childCtx := c.BranchOff(Root)
 
 	return c.app.BG().Dispatch(bg.NewTask(func() {
@@ -99,7 +120,34 @@ func (c *context) BG(f func(Ctx)) error {
 		default:
 			childCtx.End()
 		}
-	}))
+	}), o...)
+}
+
+// Do runs f through the circuit breaker with the given name, and returns its
+// error. When the call fails or is rejected by the breaker, fallback is
+// called with the error (see package circuit).
+//
+// f receives a child context which is cancelled when the breaker times out.
+func (c *context) Do(
+	name string, f func(c Ctx) error, fallback func(err error) error,
+) error {
+	return c.app.Circuit().Get(name).Do(c, func(nc goc.Context) error {
+		child := c.child()
+		child.c = nc
+		return f(child)
+	}, fallback)
+}
+
+// Go is the asynchronous version of Do. The returned channel receives the
+// error once f (or fallback) has returned.
+func (c *context) Go(
+	name string, f func(c Ctx) error, fallback func(err error) error,
+) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Do(name, f, fallback)
+	}()
+	return errc
 }
 
 // Cancel tells an operation to abandon its work.
@@ -244,15 +292,7 @@ func (c *context) stats() stats.Stats {
 // BranchOff returns a new child context that branches off from the original context
 func (c *context) BranchOff(t Type) Ctx {
 	c.Trace("ctx.journey.branch_off", "New sub context", log.String("id", c.ID))
-	ctx := &context{
-		ID:         c.ID,
-		Stepper:    c.Stepper.BranchOff(),
-		KV:         c.KV.clone(),
-		c:          nil,
-		app:        c.app,
-		logger:     c.logger,
-		cancelFunc: func() {},
-	}
+	ctx := c.child()
 
 	// If we have a root context, we break the context cancellation propagation
 	if t == Root {
@@ -269,6 +309,38 @@ func (c *context) BranchOff(t Type) Ctx {
 	return ctx
 }
 
+// WithDeadline returns a copy of ctx which is cancelled at the given
+// deadline, or when ctx is cancelled, whichever happens first. Unlike
+// BranchOff, the copy belongs to the same journey step, so it shares the
+// stepper and the values of ctx.
+func WithDeadline(ctx Ctx, d time.Time) Ctx {
+	parent, ok := ctx.(*context)
+	if !ok {
+		return ctx
+	}
+	c := *parent
+	var cancel func()
+	c.c, cancel = goc.WithDeadline(parent.c, d)
+	c.cancelFunc = func() {
+		cancel()
+		parent.cancelFunc()
+	}
+	return &c
+}
+
+// child returns a copy of c without a net context
+func (c *context) child() *context {
+	return &context{
+		ID:         c.ID,
+		Stepper:    c.Stepper.BranchOff(),
+		KV:         c.KV.clone(),
+		c:          nil,
+		app:        c.app,
+		logger:     c.logger,
+		cancelFunc: func() {},
+	}
+}
+
 // spaceOut joins the given args and separate them with spaces
 func spaceOut(args ...interface{}) string {
 	l := make([]string, len(args))
@@ -278,14 +350,18 @@ func spaceOut(args ...interface{}) string {
 	return strings.Join(l, " ")
 }
 
-func build(ctx app.Ctx) *context {
+func build(ctx app.Ctx, o ...Option) *context {
 	c := &context{
 		app:    ctx,
 		logger: ctx.L(),
 	}
+	opts := Options{}
+	for _, f := range o {
+		f(&opts)
+	}
 
 	reqConfig := c.app.Config().Request
-	if reqConfig.Timeout() != 0 {
+	if reqConfig.Timeout() != 0 && !opts.NoTimeout {
 		c.c, c.cancelFunc = goc.WithTimeout(c.app, reqConfig.Timeout())
 	} else {
 		c.c, c.cancelFunc = goc.WithCancel(c.app)
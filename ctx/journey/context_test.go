@@ -2,6 +2,7 @@ package journey_test
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -149,6 +150,31 @@ func TestTimeout(t *testing.T) {
 	}
 }
 
+// TestWithDeadline ensures that a deadline can be set without branching off
+// the journey
+func TestWithDeadline(t *testing.T) {
+	tt := lt.New(t)
+	app := tt.NewAppCtx("journey-test")
+	j := journey.New(app)
+
+	c := journey.WithDeadline(j, time.Now().Add(time.Millisecond))
+	c.Store("foo", "bar")
+	if v, _ := j.Load("foo").(string); v != "bar" {
+		tt.Errorf("expect values to be shared with the journey, but got %q", v)
+	}
+	select {
+	case <-c.Done():
+		if c.Err() != context.DeadlineExceeded {
+			tt.Errorf("expect error to be <%s>, but got <%s>", context.DeadlineExceeded, c.Err())
+		}
+	case <-time.After(time.Second):
+		tt.Error("expect deadline to release the context")
+	}
+	if j.Err() != nil {
+		tt.Errorf("expect journey not to be cancelled, but got <%s>", j.Err())
+	}
+}
+
 // TestEnd ensures that the context is being release without errors when End() is called
 func TestEnd(t *testing.T) {
 	tt := lt.New(t)
@@ -260,3 +286,35 @@ func TestJourney_MarshallingKV(t *testing.T) {
 		t.Fatalf("expect value bar, but got %s", v)
 	}
 }
+
+// TestDo tests whether Do runs commands through a circuit breaker
+func TestDo(t *testing.T) {
+	tt := lt.New(t)
+	app := tt.NewAppCtx("journey-test")
+	j := journey.New(app)
+
+	var got journey.Ctx
+	err := j.Do("cmd", func(c journey.Ctx) error {
+		got = c
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal("expect command to succeed", err)
+	}
+	if got.UUID() != j.UUID() {
+		t.Errorf("expect command to receive a child context")
+	}
+	if _, ok := got.Deadline(); !ok {
+		t.Errorf("expect command context to have the breaker timeout")
+	}
+
+	errFallback := errors.New("fallback")
+	err = <-j.Go("cmd", func(c journey.Ctx) error {
+		return errors.New("failed")
+	}, func(err error) error {
+		return errFallback
+	})
+	if err != errFallback {
+		t.Errorf("expect fallback error, but got %v", err)
+	}
+}
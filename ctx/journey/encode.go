@@ -19,8 +19,8 @@ func MarshalGob(c Ctx) ([]byte, error) {
 }
 
 // UnmarshalGob unmarshals a gob encoded context
-func UnmarshalGob(ctx app.Ctx, data []byte) (Ctx, error) {
-	c := build(ctx)
+func UnmarshalGob(ctx app.Ctx, data []byte, o ...Option) (Ctx, error) {
+	c := build(ctx, o...)
 	buf := bytes.NewBuffer(data)
 	if err := gob.NewDecoder(buf).Decode(c); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal context")
@@ -8,6 +8,9 @@ import (
 	"github.com/stairlin/lego/config"
 	"github.com/stairlin/lego/disco"
 	"github.com/stairlin/lego/disco/adapter/consul"
+	"github.com/stairlin/lego/disco/adapter/etcd"
+	"github.com/stairlin/lego/disco/adapter/serf"
+	"github.com/stairlin/lego/disco/adapter/static"
 )
 
 // Adapter returns a new agent initialised with the given config
@@ -21,6 +24,9 @@ var (
 func init() {
 	// Register default adapters
 	Register(consul.Name, consul.New)
+	Register(etcd.Name, etcd.New)
+	Register(serf.Name, serf.New)
+	Register(static.Name, static.New)
 }
 
 // Adapters returns the list of registered adapters
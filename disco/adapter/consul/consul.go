@@ -8,6 +8,7 @@ import (
 	"context"
 	"net"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -23,6 +24,9 @@ import (
 // Name contains the adapter registered name
 const Name = "consul"
 
+// weightMeta is the service metadata key which holds the instance weight
+const weightMeta = "weight"
+
 // New returns a new file config store
 func New(tree config.Tree) (disco.Agent, error) {
 	config := &Config{}
@@ -47,6 +51,7 @@ func New(tree config.Tree) (disco.Agent, error) {
 		consulConfig: cc,
 		config:       config,
 		serviceIDs:   map[string]struct{}{},
+		dc:           config.DC,
 	}, nil
 }
 
@@ -69,6 +74,8 @@ type Agent struct {
 
 	// serviceIDs caches the list of services registered
 	serviceIDs map[string]struct{}
+	// dc caches the local datacenter name
+	dc string
 }
 
 func (a *Agent) Register(ctx ctx.Ctx, r *disco.Registration) (string, error) {
@@ -79,6 +86,14 @@ func (a *Agent) Register(ctx ctx.Ctx, r *disco.Registration) (string, error) {
 		Port:    int(r.Port),
 		Address: r.Addr,
 		Tags:    tags,
+		Meta:    r.Meta,
+	}
+	if r.Weight > 0 {
+		reg.Meta = map[string]string{}
+		for k, v := range r.Meta {
+			reg.Meta[k] = v
+		}
+		reg.Meta[weightMeta] = strconv.Itoa(r.Weight)
 	}
 	if reg.ID == "" {
 		reg.ID = uuid.New().String()
@@ -143,6 +158,7 @@ func (a *Agent) Services(
 		return nil, err
 	}
 
+	dc := a.localDC()
 	svcs := map[string]disco.Service{}
 	for id, s := range r {
 		if !isSubset(s.Tags, tags) {
@@ -151,10 +167,13 @@ func (a *Agent) Services(
 
 		v, ok := svcs[s.Service]
 		if !ok {
+			name := s.Service
 			v = &service{
-				name: s.Service,
+				name: name,
 				watch: func() disco.Watcher {
-					return a.watch(ctx, s.Service, tags...)
+					return a.watch(ctx, name, disco.BuildServiceOptions(
+						disco.WithTags(tags...),
+					))
 				},
 			}
 			svcs[s.Service] = v
@@ -162,21 +181,25 @@ func (a *Agent) Services(
 
 		svc := v.(*service)
 		svc.instances = append(svc.instances, &disco.Instance{
-			ID:   id,
-			Name: s.Service,
-			Host: s.Address,
-			Port: uint16(s.Port),
-			Tags: s.Tags,
+			ID:     id,
+			Name:   s.Service,
+			Host:   s.Address,
+			Port:   uint16(s.Port),
+			Tags:   s.Tags,
+			Meta:   s.Meta,
+			DC:     dc,
+			Weight: weight(s.Meta),
 		})
 	}
 	return svcs, nil
 }
 
 func (a *Agent) Service(
-	ctx ctx.Ctx, name string, tags ...string,
+	ctx ctx.Ctx, name string, o ...disco.ServiceOption,
 ) (disco.Service, error) {
+	opts := disco.BuildServiceOptions(o...)
 	q := a.buildQueryOptions()
-	instances, _, err := a.service(ctx, name, q, tags...)
+	instances, _, err := a.service(ctx, name, q, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -184,7 +207,7 @@ func (a *Agent) Service(
 		name:      name,
 		instances: instances,
 		watch: func() disco.Watcher {
-			return a.watch(ctx, name, tags...)
+			return a.watch(ctx, name, opts)
 		},
 	}, nil
 }
@@ -204,14 +227,17 @@ func (a *Agent) Leave(ctx ctx.Ctx) {
 	a.mu.Unlock()
 }
 
+// watch returns a watcher which blocks on the local datacenter. When instances
+// of other datacenters are returned (see disco.PreferLocalDC), their updates
+// are only picked up when the local datacenter changes.
 func (a *Agent) watch(
-	ctx context.Context, name string, tags ...string,
+	ctx context.Context, name string, opts *disco.ServiceOptions,
 ) disco.Watcher {
 	var waitIndex uint64
 	next := func(ctx context.Context) ([]*disco.Instance, error) {
 		q := a.buildQueryOptions()
 		q.WaitIndex = waitIndex
-		instances, meta, err := a.service(ctx, name, q, tags...)
+		instances, meta, err := a.service(ctx, name, q, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -221,36 +247,98 @@ func (a *Agent) watch(
 	return newWatcher(ctx, next)
 }
 
+// service queries the health endpoint of the local datacenter. When there are
+// no matching instances and opts prefers the local datacenter, other
+// datacenters are queried by order of distance.
 func (a *Agent) service(
-	ctx context.Context, name string, q *api.QueryOptions, tags ...string,
+	ctx context.Context,
+	name string,
+	q *api.QueryOptions,
+	opts *disco.ServiceOptions,
+) ([]*disco.Instance, *api.QueryMeta, error) {
+	instances, meta, err := a.healthService(name, q, opts)
+	if err != nil || len(instances) > 0 || !opts.PreferLocalDC {
+		return instances, meta, err
+	}
+
+	dcs, err := a.consul.Catalog().Datacenters()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot list datacenters")
+	}
+	for _, dc := range dcs {
+		if dc == a.localDC() {
+			continue
+		}
+		rq := a.buildQueryOptions()
+		rq.Datacenter = dc
+		l, _, err := a.healthService(name, rq, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(l) > 0 {
+			return l, meta, nil
+		}
+	}
+	return nil, meta, nil
+}
+
+func (a *Agent) healthService(
+	name string, q *api.QueryOptions, opts *disco.ServiceOptions,
 ) ([]*disco.Instance, *api.QueryMeta, error) {
 	var tag string
-	if len(tags) > 0 {
-		tag = tags[0]
+	if len(opts.Tags) > 0 {
+		tag = opts.Tags[0]
 	}
 
-	r, meta, err := a.consul.Health().Service(name, tag, true, q)
+	r, meta, err := a.consul.Health().Service(name, tag, opts.Passing, q)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	var instances []*disco.Instance
-	for _, chk := range r {
-		if !isSubset(chk.Service.Tags, tags) {
-			continue
-		}
+	dc := a.localDC()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-		_, local := a.serviceIDs[chk.Service.ID]
+	var instances []*disco.Instance
+	for _, entry := range r {
+		_, local := a.serviceIDs[entry.Service.ID]
 		instances = append(instances, &disco.Instance{
-			Local: local,
-			ID:    chk.Service.ID,
-			Name:  chk.Service.Service,
-			Host:  chk.Service.Address,
-			Port:  uint16(chk.Service.Port),
-			Tags:  chk.Service.Tags,
+			Local:  local,
+			ID:     entry.Service.ID,
+			Name:   entry.Service.Service,
+			Host:   entry.Service.Address,
+			Port:   uint16(entry.Service.Port),
+			Tags:   entry.Service.Tags,
+			Meta:   entry.Service.Meta,
+			Health: healthStatus(entry.Checks),
+			DC:     entry.Node.Datacenter,
+			Weight: weight(entry.Service.Meta),
 		})
 	}
-	return instances, meta, nil
+	return opts.Filter(instances, dc), meta, nil
+}
+
+// localDC returns the datacenter of the agent. It is fetched from Consul
+// when it is not configured.
+func (a *Agent) localDC() string {
+	a.mu.Lock()
+	dc := a.dc
+	a.mu.Unlock()
+	if dc != "" {
+		return dc
+	}
+
+	self, err := a.consul.Agent().Self()
+	if err != nil {
+		return ""
+	}
+	dc, _ = self["Config"]["Datacenter"].(string)
+
+	a.mu.Lock()
+	a.dc = dc
+	a.mu.Unlock()
+	return dc
 }
 
 func (a *Agent) buildQueryOptions() *api.QueryOptions {
@@ -315,6 +403,28 @@ func (w *watcher) Close() error {
 	return nil
 }
 
+// healthStatus returns the aggregated status of the given checks
+func healthStatus(checks api.HealthChecks) disco.HealthStatus {
+	status := disco.Passing
+	for _, chk := range checks {
+		switch chk.Status {
+		case api.HealthCritical, api.HealthMaint:
+			return disco.Critical
+		case api.HealthWarning:
+			status = disco.Warning
+		}
+	}
+	return status
+}
+
+// weight returns the instance weight stored in its metadata
+func weight(meta map[string]string) int {
+	if w, err := strconv.Atoi(meta[weightMeta]); err == nil && w > 0 {
+		return w
+	}
+	return 1
+}
+
 // isSubset returns whether b is a subset of a
 func isSubset(a, b []string) bool {
 	if len(a) < len(b) {
@@ -0,0 +1,398 @@
+// Package etcd is a service discovery adapter backed by etcd v3
+//
+// Each registered service instance is stored as a key attached to a lease,
+// which is kept alive as long as the instance is registered. When a node dies,
+// its lease expires and etcd removes the instances it was offering.
+//
+// Keys are laid out as <prefix>/<service name>/<instance id>.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/config"
+	"github.com/stairlin/lego/ctx"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Name contains the adapter registered name
+const Name = "etcd"
+
+const (
+	// DefaultPrefix is the default key prefix under which instances are stored
+	DefaultPrefix = "/lego/disco"
+	// DefaultTTL is the default lease TTL in seconds
+	DefaultTTL = 10
+	// DefaultDialTimeout is the default timeout to connect to etcd
+	DefaultDialTimeout = 5 * time.Second
+)
+
+// Config contains the configuration to start a service discovery agent
+type Config struct {
+	Endpoints     []string `toml:"endpoints"`
+	Prefix        string   `toml:"prefix"`
+	DC            string   `toml:"dc"`
+	TTL           int64    `toml:"ttl"`
+	DialTimeoutMS int      `toml:"dial_timeout_ms"`
+	Username      string   `toml:"username"`
+	Password      string   `toml:"password"`
+	DefaultTags   []string `toml:"default_tags"`
+}
+
+// New returns a new etcd agent
+func New(tree config.Tree) (disco.Agent, error) {
+	config := &Config{}
+	if err := tree.Unmarshal(config); err != nil {
+		return nil, err
+	}
+	if len(config.Endpoints) == 0 {
+		return nil, errors.New("missing etcd endpoints")
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+	dialTimeout := DefaultDialTimeout
+	if config.DialTimeoutMS > 0 {
+		dialTimeout = time.Duration(config.DialTimeoutMS) * time.Millisecond
+	}
+
+	etcd, err := clientv3.New(clientv3.Config{
+		Endpoints:   config.Endpoints,
+		DialTimeout: dialTimeout,
+		Username:    config.Username,
+		Password:    config.Password,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot initialise etcd client")
+	}
+	return NewWithClient(etcd, config), nil
+}
+
+// NewWithClient returns a new etcd agent which uses the given client
+func NewWithClient(etcd *clientv3.Client, config *Config) *Agent {
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+	return &Agent{
+		etcd:          etcd,
+		config:        config,
+		registrations: map[string]*registration{},
+	}
+}
+
+// Agent implements disco.Agent
+type Agent struct {
+	mu sync.Mutex
+
+	etcd   *clientv3.Client
+	config *Config
+
+	// registrations contains all services registered by this agent
+	registrations map[string]*registration
+}
+
+// record is the value stored for each instance
+type record struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Host   string            `json:"host"`
+	Port   uint16            `json:"port"`
+	Tags   []string          `json:"tags,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty"`
+	DC     string            `json:"dc,omitempty"`
+	Weight int               `json:"weight,omitempty"`
+}
+
+// registration is a service registered by this agent
+type registration struct {
+	cancel func()
+	done   chan struct{}
+	lease  clientv3.LeaseID
+}
+
+func (a *Agent) Register(ctx ctx.Ctx, r *disco.Registration) (string, error) {
+	rec := &record{
+		ID:     r.ID,
+		Name:   r.Name,
+		Host:   r.Addr,
+		Port:   r.Port,
+		Tags:   append(a.config.DefaultTags, r.Tags...),
+		Meta:   r.Meta,
+		DC:     a.config.DC,
+		Weight: r.Weight,
+	}
+	if rec.ID == "" {
+		rec.ID = uuid.New().String()
+	}
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot encode instance")
+	}
+	key := a.key(rec.Name, rec.ID)
+
+	ctx.Trace("disco.register", "Register service",
+		log.String("adapter", Name),
+		log.String("service_name", rec.Name),
+		log.String("instance_id", rec.ID),
+		log.String("instance_address", rec.Host),
+		log.Uint("instance_port", uint(rec.Port)),
+		log.String("instance_tags", strings.Join(rec.Tags, ", ")),
+	)
+	lease, err := a.put(ctx, key, string(value))
+	if err != nil {
+		return "", err
+	}
+
+	kaCtx, cancel := context.WithCancel(context.Background())
+	reg := &registration{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		lease:  lease,
+	}
+	a.mu.Lock()
+	if prev, ok := a.registrations[rec.ID]; ok {
+		prev.cancel()
+	}
+	a.registrations[rec.ID] = reg
+	a.mu.Unlock()
+
+	go a.keepAlive(kaCtx, ctx, reg, key, string(value))
+	return rec.ID, nil
+}
+
+func (a *Agent) Deregister(ctx ctx.Ctx, id string) error {
+	ctx.Trace("disco.deregister", "Deregister service",
+		log.String("id", id),
+		log.String("adapter", Name),
+	)
+
+	a.mu.Lock()
+	reg, ok := a.registrations[id]
+	delete(a.registrations, id)
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	// Stop keeping the lease alive, and then revoke it to delete the key
+	reg.cancel()
+	<-reg.done
+	if _, err := a.etcd.Revoke(ctx, reg.lease); err != nil {
+		return errors.Wrap(err, "cannot revoke lease")
+	}
+	return nil
+}
+
+func (a *Agent) Services(
+	ctx ctx.Ctx, tags ...string,
+) (map[string]disco.Service, error) {
+	instances, _, err := a.instances(ctx, a.config.Prefix+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := disco.BuildServiceOptions(disco.WithTags(tags...))
+	svcs := map[string]disco.Service{}
+	for _, i := range opts.Filter(instances, a.config.DC) {
+		v, ok := svcs[i.Name]
+		if !ok {
+			name := i.Name
+			v = &service{
+				name: name,
+				watch: func() disco.Watcher {
+					return a.watch(ctx, name, opts)
+				},
+			}
+			svcs[name] = v
+		}
+		svc := v.(*service)
+		svc.instances = append(svc.instances, i)
+	}
+	return svcs, nil
+}
+
+func (a *Agent) Service(
+	ctx ctx.Ctx, name string, o ...disco.ServiceOption,
+) (disco.Service, error) {
+	opts := disco.BuildServiceOptions(o...)
+	instances, _, err := a.instances(ctx, a.servicePrefix(name))
+	if err != nil {
+		return nil, err
+	}
+	return &service{
+		name:      name,
+		instances: opts.Filter(instances, a.config.DC),
+		watch: func() disco.Watcher {
+			return a.watch(ctx, name, opts)
+		},
+	}, nil
+}
+
+func (a *Agent) Leave(ctx ctx.Ctx) {
+	a.mu.Lock()
+	var ids []string
+	for id := range a.registrations {
+		ids = append(ids, id)
+	}
+	a.mu.Unlock()
+
+	for _, id := range ids {
+		err := a.Deregister(ctx, id)
+		if err != nil {
+			ctx.Warning("disco.leave.failure", "Could not de-register service",
+				log.String("service_id", id),
+				log.Error(err),
+			)
+		}
+	}
+}
+
+// put grants a new lease and attaches the key to it
+func (a *Agent) put(ctx context.Context, key, value string) (clientv3.LeaseID, error) {
+	grant, err := a.etcd.Grant(ctx, a.config.TTL)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot grant lease")
+	}
+	_, err = a.etcd.Put(ctx, key, value, clientv3.WithLease(grant.ID))
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot put instance")
+	}
+	return grant.ID, nil
+}
+
+// keepAlive keeps the registration lease alive until it is cancelled. When
+// the lease is lost (e.g. network partition longer than the TTL), the
+// instance is registered again with a new lease.
+func (a *Agent) keepAlive(
+	kaCtx context.Context, ctx ctx.Ctx, reg *registration, key, value string,
+) {
+	defer close(reg.done)
+
+	backoff := time.Second
+	for {
+		a.mu.Lock()
+		lease := reg.lease
+		a.mu.Unlock()
+
+		ch, err := a.etcd.KeepAlive(kaCtx, lease)
+		if err == nil {
+			for range ch {
+				backoff = time.Second
+			}
+		}
+		if kaCtx.Err() != nil {
+			return
+		}
+
+		ctx.Warning("disco.etcd.lease_lost", "Registration lease lost",
+			log.String("key", key),
+			log.Error(err),
+		)
+		select {
+		case <-kaCtx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Duration(a.config.TTL)*time.Second {
+			backoff *= 2
+		}
+
+		lease, err = a.put(kaCtx, key, value)
+		if err != nil {
+			continue
+		}
+		a.mu.Lock()
+		reg.lease = lease
+		a.mu.Unlock()
+	}
+}
+
+// instances returns all instances stored under prefix, along with the
+// revision at which they have been read
+func (a *Agent) instances(
+	ctx context.Context, prefix string,
+) ([]*disco.Instance, int64, error) {
+	r, err := a.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot get instances")
+	}
+
+	instances := make([]*disco.Instance, 0, len(r.Kvs))
+	for _, kv := range r.Kvs {
+		i, err := a.decode(kv.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		instances = append(instances, i)
+	}
+	return instances, r.Header.Revision, nil
+}
+
+func (a *Agent) decode(value []byte) (*disco.Instance, error) {
+	rec := &record{}
+	if err := json.Unmarshal(value, rec); err != nil {
+		return nil, errors.Wrap(err, "cannot decode instance")
+	}
+
+	a.mu.Lock()
+	_, local := a.registrations[rec.ID]
+	a.mu.Unlock()
+
+	i := &disco.Instance{
+		Local:  local,
+		ID:     rec.ID,
+		Name:   rec.Name,
+		Host:   rec.Host,
+		Port:   rec.Port,
+		Tags:   rec.Tags,
+		Meta:   rec.Meta,
+		DC:     rec.DC,
+		Weight: rec.Weight,
+	}
+	if i.Weight <= 0 {
+		i.Weight = 1
+	}
+	return i, nil
+}
+
+func (a *Agent) key(name, id string) string {
+	return path.Join(a.config.Prefix, name, id)
+}
+
+func (a *Agent) servicePrefix(name string) string {
+	return path.Join(a.config.Prefix, name) + "/"
+}
+
+// service implements disco.Service
+type service struct {
+	name      string
+	instances []*disco.Instance
+	watch     func() disco.Watcher
+}
+
+func (s *service) Name() string {
+	return s.name
+}
+
+func (s *service) Watch() disco.Watcher {
+	return s.watch()
+}
+
+func (s *service) Instances() []*disco.Instance {
+	return s.instances
+}
@@ -0,0 +1,175 @@
+package etcd_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/config"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/disco/adapter/etcd"
+	lt "github.com/stairlin/lego/testing"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func TestRegistration(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("etcd-test")
+	agent, stop := newAgent(t)
+	defer stop()
+
+	id, err := agent.Register(ctx, &disco.Registration{
+		Name:   "api.http",
+		Addr:   "127.0.0.1",
+		Port:   3000,
+		Tags:   []string{"v1"},
+		Meta:   map[string]string{"az": "1"},
+		Weight: 2,
+	})
+	if err != nil {
+		t.Fatal("expect to be able to register service", err)
+	}
+
+	svc, err := agent.Service(ctx, "api.http", disco.WithTags("v1"))
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	instances := svc.Instances()
+	if len(instances) != 1 {
+		t.Fatalf("expect 1 instance, but got %d", len(instances))
+	}
+	i := instances[0]
+	if i.ID != id || !i.Local || i.Addr() != "127.0.0.1:3000" {
+		t.Errorf("expect instance to be registered, but got %+v", i)
+	}
+	if i.Meta["az"] != "1" || i.Weight != 2 {
+		t.Errorf("expect instance metadata to be stored, but got %+v", i)
+	}
+
+	svcs, err := agent.Services(ctx, "v2")
+	if err != nil {
+		t.Fatal("expect to be able to list services", err)
+	}
+	if len(svcs) != 0 {
+		t.Errorf("expect services to be filtered by tags, but got %d", len(svcs))
+	}
+
+	agent.Leave(ctx)
+	svc, err = agent.Service(ctx, "api.http")
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	if n := len(svc.Instances()); n != 0 {
+		t.Errorf("expect instances to be removed on leave, but got %d", n)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("etcd-test")
+	agent, stop := newAgent(t)
+	defer stop()
+
+	svc, err := agent.Service(ctx, "api.http")
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	w := svc.Watch()
+	defer w.Close()
+
+	events, err := w.Next()
+	if err != nil {
+		t.Fatal("expect to get the initial state", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expect no instances, but got %d events", len(events))
+	}
+
+	id, err := agent.Register(ctx, &disco.Registration{
+		Name: "api.http",
+		Addr: "127.0.0.1",
+		Port: 3000,
+	})
+	if err != nil {
+		t.Fatal("expect to be able to register service", err)
+	}
+	events, err = w.Next()
+	if err != nil {
+		t.Fatal("expect to get an update", err)
+	}
+	if len(events) != 1 || events[0].Op != disco.Add || events[0].Instance.ID != id {
+		t.Errorf("expect instance to be added, but got %v", events)
+	}
+
+	if err := agent.Deregister(ctx, id); err != nil {
+		t.Fatal("expect to be able to deregister service", err)
+	}
+	events, err = w.Next()
+	if err != nil {
+		t.Fatal("expect to get an update", err)
+	}
+	if len(events) != 1 || events[0].Op != disco.Delete {
+		t.Errorf("expect instance to be deleted, but got %v", events)
+	}
+
+	w.Close()
+	if _, err := w.Next(); err != disco.ErrWatcherClosed {
+		t.Errorf("expect watcher to be closed, but got %v", err)
+	}
+}
+
+// newAgent starts an embedded etcd server and returns an agent connected to it,
+// along with a function to stop the server
+func newAgent(t *testing.T) (disco.Agent, func()) {
+	dir, err := ioutil.TempDir("", "lego-etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.ListenClientUrls = []url.URL{freeURL(t)}
+	cfg.AdvertiseClientUrls = cfg.ListenClientUrls
+	cfg.ListenPeerUrls = []url.URL{freeURL(t)}
+	cfg.AdvertisePeerUrls = cfg.ListenPeerUrls
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal("cannot start embedded etcd", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("embedded etcd took too long to start")
+	}
+
+	tree, err := config.LoadTree(strings.NewReader(fmt.Sprintf(
+		"endpoints = [%q]\nttl = 5", cfg.ListenClientUrls[0].String(),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := etcd.New(tree)
+	if err != nil {
+		t.Fatal("cannot create agent", err)
+	}
+
+	return agent, func() {
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
@@ -0,0 +1,134 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+
+	"github.com/stairlin/lego/disco"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func (a *Agent) watch(
+	ctx context.Context, name string, opts *disco.ServiceOptions,
+) disco.Watcher {
+	child, cancelFunc := context.WithCancel(ctx)
+	return &watcher{
+		agent:  a,
+		prefix: a.servicePrefix(name),
+		opts:   opts,
+		ctx:    child,
+		cancel: cancelFunc,
+	}
+}
+
+// watcher reads a snapshot of a service, and then applies etcd watch events
+// on it. Events are generated by diffing the filtered snapshots.
+type watcher struct {
+	agent  *Agent
+	prefix string
+	opts   *disco.ServiceOptions
+	ctx    context.Context
+	cancel func()
+
+	synced bool
+	state  map[string]*disco.Instance
+	wch    clientv3.WatchChan
+	diff   disco.Diff
+}
+
+func (w *watcher) Next() ([]*disco.Event, error) {
+	for {
+		if w.ctx.Err() != nil {
+			return nil, disco.ErrWatcherClosed
+		}
+
+		// (Re)build the snapshot, either on the first call or when the watch
+		// stream has been interrupted (e.g. compaction)
+		if w.wch == nil {
+			first := !w.synced
+			if err := w.sync(); err != nil {
+				return nil, err
+			}
+			if events := w.apply(); first || len(events) > 0 {
+				return events, nil
+			}
+			continue
+		}
+
+		var resp clientv3.WatchResponse
+		var ok bool
+		select {
+		case <-w.ctx.Done():
+			return nil, disco.ErrWatcherClosed
+		case resp, ok = <-w.wch:
+		}
+		if !ok || resp.Err() != nil {
+			w.wch = nil
+			continue
+		}
+
+		for _, ev := range resp.Events {
+			key := string(ev.Kv.Key)
+			switch ev.Type {
+			case mvccpb.PUT:
+				i, err := w.agent.decode(ev.Kv.Value)
+				if err != nil {
+					continue
+				}
+				w.state[key] = i
+			case mvccpb.DELETE:
+				delete(w.state, key)
+			}
+		}
+		if events := w.apply(); len(events) > 0 {
+			return events, nil
+		}
+	}
+}
+
+func (w *watcher) Close() error {
+	w.cancel()
+	return nil
+}
+
+// sync reads the current snapshot and starts watching from its revision
+func (w *watcher) sync() error {
+	r, err := w.agent.etcd.Get(w.ctx, w.prefix, clientv3.WithPrefix())
+	if err != nil {
+		if w.ctx.Err() != nil {
+			return disco.ErrWatcherClosed
+		}
+		return err
+	}
+
+	w.state = map[string]*disco.Instance{}
+	for _, kv := range r.Kvs {
+		i, err := w.agent.decode(kv.Value)
+		if err != nil {
+			continue
+		}
+		w.state[string(kv.Key)] = i
+	}
+	w.synced = true
+	w.wch = w.agent.etcd.Watch(w.ctx, w.prefix,
+		clientv3.WithPrefix(),
+		clientv3.WithRev(r.Header.Revision+1),
+	)
+	return nil
+}
+
+// apply returns the events needed to reach the current state
+func (w *watcher) apply() []*disco.Event {
+	keys := make([]string, 0, len(w.state))
+	for k := range w.state {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	instances := make([]*disco.Instance, len(keys))
+	for i, k := range keys {
+		instances[i] = w.state[k]
+	}
+	return w.diff.Apply(w.opts.Filter(instances, w.agent.config.DC))
+}
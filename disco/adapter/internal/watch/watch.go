@@ -0,0 +1,172 @@
+// Package watch implements the services and watchers of adapters which can
+// list their instances, but are not notified of individual changes.
+//
+// Watchers are woken up by Notify, and then diff the current instances with
+// the ones they have already delivered. Notify never blocks, and changes which
+// happen between two calls to Next are coalesced.
+package watch
+
+import (
+	"sync"
+
+	"github.com/stairlin/lego/disco"
+)
+
+// Set is a set of instances followed by watchers
+type Set struct {
+	dc        string
+	instances func(name string) []*disco.Instance
+
+	mu sync.Mutex
+	// changed is closed (and replaced) whenever the instances change
+	changed chan struct{}
+
+	once sync.Once
+	done chan struct{}
+}
+
+// New returns a set of instances listed by f. f returns the instances of the
+// given service sorted by ID, or the instances of all services when name is
+// empty. dc is the datacenter of the agent.
+func New(dc string, f func(name string) []*disco.Instance) *Set {
+	return &Set{
+		dc:        dc,
+		instances: f,
+		changed:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Notify wakes up all watchers
+func (s *Set) Notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Close closes all watchers, including the ones created afterwards
+func (s *Set) Close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// Services returns the services which have instances with the given tags
+func (s *Set) Services(tags ...string) map[string]disco.Service {
+	opts := disco.BuildServiceOptions(disco.WithTags(tags...))
+	svcs := map[string]disco.Service{}
+	for _, i := range opts.Filter(s.instances(""), s.dc) {
+		v, ok := svcs[i.Name]
+		if !ok {
+			v = s.service(i.Name, opts, nil)
+			svcs[i.Name] = v
+		}
+		svc := v.(*service)
+		svc.instances = append(svc.instances, i)
+	}
+	return svcs
+}
+
+// Service returns the instances of name which match the options. The service
+// does not need to exist yet, which allows to watch for services registered
+// later.
+func (s *Set) Service(name string, o ...disco.ServiceOption) disco.Service {
+	opts := disco.BuildServiceOptions(o...)
+	return s.service(name, opts, opts.Filter(s.instances(name), s.dc))
+}
+
+func (s *Set) service(
+	name string, opts *disco.ServiceOptions, instances []*disco.Instance,
+) *service {
+	return &service{
+		name:      name,
+		instances: instances,
+		watch: func() disco.Watcher {
+			return &watcher{
+				set:   s,
+				name:  name,
+				opts:  opts,
+				close: make(chan struct{}),
+			}
+		},
+	}
+}
+
+// service implements disco.Service
+type service struct {
+	name      string
+	instances []*disco.Instance
+	watch     func() disco.Watcher
+}
+
+func (s *service) Name() string {
+	return s.name
+}
+
+func (s *service) Watch() disco.Watcher {
+	return s.watch()
+}
+
+func (s *service) Instances() []*disco.Instance {
+	return s.instances
+}
+
+// watcher diffs the instances of a service every time the set changes
+type watcher struct {
+	set  *Set
+	name string
+	opts *disco.ServiceOptions
+
+	once    sync.Once
+	close   chan struct{}
+	synced  bool
+	changed chan struct{}
+	diff    disco.Diff
+}
+
+// Next returns the initial snapshot on the first call, even when it is empty,
+// and then blocks until the instances change
+func (w *watcher) Next() ([]*disco.Event, error) {
+	for {
+		select {
+		case <-w.close:
+			return nil, disco.ErrWatcherClosed
+		case <-w.set.done:
+			return nil, disco.ErrWatcherClosed
+		default:
+		}
+
+		if w.synced {
+			select {
+			case <-w.close:
+				return nil, disco.ErrWatcherClosed
+			case <-w.set.done:
+				return nil, disco.ErrWatcherClosed
+			case <-w.changed:
+			}
+		}
+
+		// Changes which happen from now on will be picked up by the next call
+		w.set.mu.Lock()
+		w.changed = w.set.changed
+		w.set.mu.Unlock()
+
+		first := !w.synced
+		w.synced = true
+		instances := w.opts.Filter(w.set.instances(w.name), w.set.dc)
+		if events := w.diff.Apply(instances); first || len(events) > 0 {
+			return events, nil
+		}
+	}
+}
+
+// Close closes the watcher. Pending and future calls to Next return
+// disco.ErrWatcherClosed.
+func (w *watcher) Close() error {
+	w.once.Do(func() {
+		close(w.close)
+	})
+	return nil
+}
@@ -2,29 +2,32 @@ package adapter
 
 import (
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/google/uuid"
 	"github.com/stairlin/lego/ctx"
 	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/disco/adapter/internal/watch"
 	"github.com/stairlin/lego/log"
 )
 
 // localAgent is a local-only service discovery agent
 // This agent is used when service discovery is disabled
 type localAgent struct {
-	mu sync.RWMutex
+	mu sync.Mutex
 
-	Registry map[string]*disco.Instance
-	// subs contains all event subscriptions
-	Subs map[chan *disco.Event]struct{}
+	registry map[string]*disco.Instance
+	// set is notified whenever the registry changes
+	set *watch.Set
 }
 
 func newLocalAgent() disco.Agent {
-	return &localAgent{
-		Registry: map[string]*disco.Instance{},
-		Subs:     map[chan *disco.Event]struct{}{},
+	a := &localAgent{
+		registry: map[string]*disco.Instance{},
 	}
+	a.set = watch.New("", a.instances)
+	return a
 }
 
 func (a *localAgent) Register(ctx ctx.Ctx, r *disco.Registration) (string, error) {
@@ -35,27 +38,24 @@ func (a *localAgent) Register(ctx ctx.Ctx, r *disco.Registration) (string, error
 	if id == "" {
 		id = uuid.New().String()
 	}
-	if _, ok := a.Registry[id]; ok {
+	if _, ok := a.registry[id]; ok {
 		return "", errors.New("service already registered")
 	}
 	instance := &disco.Instance{
-		Local: true,
-		ID:    id,
-		Name:  r.Name,
-		Host:  r.Addr,
-		Port:  r.Port,
-		Tags:  r.Tags,
+		Local:  true,
+		ID:     id,
+		Name:   r.Name,
+		Host:   r.Addr,
+		Port:   r.Port,
+		Tags:   r.Tags,
+		Meta:   r.Meta,
+		Weight: r.Weight,
 	}
-	a.Registry[id] = instance
-
-	// Notifiy subscribers
-	for sub := range a.Subs {
-		sub <- &disco.Event{
-			Op:       disco.Add,
-			Instance: instance,
-		}
+	if instance.Weight <= 0 {
+		instance.Weight = 1
 	}
-
+	a.registry[id] = instance
+	a.set.Notify()
 	return id, nil
 }
 
@@ -69,34 +69,21 @@ func (a *localAgent) Deregister(ctx ctx.Ctx, id string) error {
 func (a *localAgent) Services(
 	ctx ctx.Ctx, tags ...string,
 ) (map[string]disco.Service, error) {
-	a.mu.RLock()
-	defer a.mu.RUnlock()
-
-	return a.services(ctx, tags...)
+	return a.set.Services(tags...), nil
 }
 
 func (a *localAgent) Service(
-	ctx ctx.Ctx, name string, tags ...string,
+	ctx ctx.Ctx, name string, o ...disco.ServiceOption,
 ) (disco.Service, error) {
-	a.mu.RLock()
-	defer a.mu.RUnlock()
-
-	services, err := a.services(ctx, tags...)
-	if err != nil {
-		return nil, err
-	}
-	s, ok := services[name]
-	if !ok {
-		return nil, errors.New("service does not exist")
-	}
-	return s, nil
+	return a.set.Service(name, o...), nil
 }
 
+// Leave de-registers all services and closes all watchers
 func (a *localAgent) Leave(ctx ctx.Ctx) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	for id := range a.Registry {
+	for id := range a.registry {
 		err := a.deregister(ctx, id)
 		if err != nil {
 			ctx.Warning("disco.leave.failure", "Could not de-register service",
@@ -104,86 +91,33 @@ func (a *localAgent) Leave(ctx ctx.Ctx) {
 			)
 		}
 	}
-	a.Registry = map[string]*disco.Instance{}
-	a.Subs = map[chan *disco.Event]struct{}{}
+	a.set.Close()
 }
 
-func (a *localAgent) services(
-	ctx ctx.Ctx, tags ...string,
-) (map[string]disco.Service, error) {
-	services := map[string]disco.Service{}
-	for _, instance := range a.Registry {
-		services[instance.Name] = &service{
-			name:      instance.Name,
-			instances: []*disco.Instance{instance},
-			watch: func() disco.Watcher {
-				sub := make(chan *disco.Event, 1)
-				unsub := func() {
-					delete(a.Subs, sub)
-				}
-				a.Subs[sub] = struct{}{}
-				return &watcher{
-					sub:   sub,
-					unsub: unsub,
-				}
-			},
+// instances returns the registered instances. When name is empty, instances
+// of all services are returned.
+func (a *localAgent) instances(name string) []*disco.Instance {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var instances []*disco.Instance
+	for _, instance := range a.registry {
+		if name != "" && instance.Name != name {
+			continue
 		}
+		instances = append(instances, instance)
 	}
-	return services, nil
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
 }
 
 func (a *localAgent) deregister(ctx ctx.Ctx, id string) error {
-	instance, ok := a.Registry[id]
-	if !ok {
+	if _, ok := a.registry[id]; !ok {
 		return nil
 	}
-	delete(a.Registry, id)
-
-	// Notifiy subscribers
-	for sub := range a.Subs {
-		sub <- &disco.Event{
-			Op:       disco.Delete,
-			Instance: instance,
-		}
-	}
-
-	return nil
-}
-
-// service implements disco.Service
-type service struct {
-	name      string
-	instances []*disco.Instance
-	watch     func() disco.Watcher
-}
-
-func (s *service) Name() string {
-	return s.name
-}
-
-func (s *service) Watch() disco.Watcher {
-	return s.watch()
-}
-
-func (s *service) Instances() []*disco.Instance {
-	return s.instances
-}
-
-type watcher struct {
-	sub   chan *disco.Event
-	unsub func()
-}
-
-func (w *watcher) Next() ([]*disco.Event, error) {
-	e, ok := <-w.sub
-	if !ok {
-		return nil, disco.ErrWatcherClosed
-	}
-	return []*disco.Event{e}, nil
-}
-
-func (w *watcher) Close() error {
-	w.unsub()
-	close(w.sub)
+	delete(a.registry, id)
+	a.set.Notify()
 	return nil
 }
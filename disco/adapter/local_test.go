@@ -0,0 +1,222 @@
+package adapter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/ctx/app"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/disco/adapter"
+	lt "github.com/stairlin/lego/testing"
+)
+
+func TestLocalServices(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("local-test")
+	agent := adapter.Local()
+
+	register(t, ctx, agent, "a", "api.http", "v1")
+	register(t, ctx, agent, "b", "api.http", "v2")
+	register(t, ctx, agent, "c", "api.grpc", "v1")
+
+	svcs, err := agent.Services(ctx)
+	if err != nil {
+		t.Fatal("expect to be able to list services", err)
+	}
+	if n := len(svcs["api.http"].Instances()); n != 2 {
+		t.Errorf("expect 2 api.http instances, but got %d", n)
+	}
+	svcs, err = agent.Services(ctx, "v1")
+	if err != nil {
+		t.Fatal("expect to be able to list services", err)
+	}
+	if len(svcs) != 2 || len(svcs["api.http"].Instances()) != 1 {
+		t.Errorf("expect services to be filtered by tags, but got %v", svcs)
+	}
+
+	svc, err := agent.Service(ctx, "api.http", disco.WithTags("v2"))
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	if l := svc.Instances(); len(l) != 1 || l[0].ID != "b" {
+		t.Errorf("expect instance b, but got %v", l)
+	}
+
+	svc, err = agent.Service(ctx, "unknown")
+	if err != nil {
+		t.Fatal("expect to be able to get an unknown service", err)
+	}
+	if n := len(svc.Instances()); n != 0 {
+		t.Errorf("expect no instances, but got %d", n)
+	}
+}
+
+func TestLocalWatchSnapshot(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("local-test")
+	agent := adapter.Local()
+
+	register(t, ctx, agent, "a", "api.http")
+	register(t, ctx, agent, "b", "api.http")
+	register(t, ctx, agent, "c", "api.grpc")
+
+	w := watch(t, ctx, agent, "api.http")
+	defer w.Close()
+	events := next(t, w)
+	if len(events) != 2 || events[0].Instance.ID != "a" || events[1].Instance.ID != "b" {
+		t.Fatalf("expect a snapshot with a and b, but got %v", events)
+	}
+	for _, e := range events {
+		if e.Op != disco.Add {
+			t.Errorf("expect snapshot events to be additions, but got %v", e.Op)
+		}
+	}
+
+	// Empty snapshot
+	w = watch(t, ctx, agent, "unknown")
+	defer w.Close()
+	if events := next(t, w); len(events) != 0 {
+		t.Errorf("expect an empty snapshot, but got %v", events)
+	}
+
+	// Other services are not delivered
+	register(t, ctx, agent, "d", "api.grpc")
+	register(t, ctx, agent, "e", "unknown")
+	if events := next(t, w); len(events) != 1 || events[0].Instance.ID != "e" {
+		t.Errorf("expect only e to be delivered, but got %v", events)
+	}
+	agent.Leave(ctx)
+}
+
+func TestLocalWatchCoalesce(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("local-test")
+	agent := adapter.Local()
+
+	register(t, ctx, agent, "a", "api.http")
+	w := watch(t, ctx, agent, "api.http")
+	defer w.Close()
+	next(t, w)
+
+	// Nobody reads the watcher, so registrations must not block
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := add(ctx, agent, "b", "api.http"); err != nil {
+				t.Error("expect to be able to register service", err)
+			}
+			agent.Deregister(ctx, "b")
+		}
+		// a is registered again with other tags, so it is updated
+		agent.Deregister(ctx, "a")
+		if err := add(ctx, agent, "a", "api.http", "v2"); err != nil {
+			t.Error("expect to be able to register service", err)
+		}
+		if err := add(ctx, agent, "c", "api.http"); err != nil {
+			t.Error("expect to be able to register service", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect registrations not to block on watchers")
+	}
+
+	events := next(t, w)
+	if len(events) != 2 {
+		t.Fatalf("expect 2 coalesced events, but got %v", events)
+	}
+	if events[0].Op != disco.Update || events[0].Instance.ID != "a" {
+		t.Errorf("expect a to be updated, but got %v", events[0])
+	}
+	if events[1].Op != disco.Add || events[1].Instance.ID != "c" {
+		t.Errorf("expect c to be added, but got %v", events[1])
+	}
+}
+
+func TestLocalWatchClose(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("local-test")
+	agent := adapter.Local()
+
+	w := watch(t, ctx, agent, "api.http")
+	next(t, w)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := w.Next()
+		errc <- err
+	}()
+	w.Close()
+	select {
+	case err := <-errc:
+		if err != disco.ErrWatcherClosed {
+			t.Errorf("expect watcher to be closed, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect Close to unblock Next")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("expect Close to be idempotent, but got %v", err)
+	}
+	register(t, ctx, agent, "a", "api.http")
+
+	// Leave closes all watchers
+	w = watch(t, ctx, agent, "api.http")
+	next(t, w)
+	agent.Leave(ctx)
+	if _, err := w.Next(); err != disco.ErrWatcherClosed {
+		t.Errorf("expect watcher to be closed on leave, but got %v", err)
+	}
+}
+
+func register(
+	t *testing.T, ctx app.Ctx, agent disco.Agent, id, name string, tags ...string,
+) {
+	if err := add(ctx, agent, id, name, tags...); err != nil {
+		t.Fatal("expect to be able to register service", err)
+	}
+}
+
+func add(ctx app.Ctx, agent disco.Agent, id, name string, tags ...string) error {
+	_, err := agent.Register(ctx, &disco.Registration{
+		ID:   id,
+		Name: name,
+		Addr: "127.0.0.1",
+		Port: 3000,
+		Tags: tags,
+	})
+	return err
+}
+
+func watch(t *testing.T, ctx app.Ctx, agent disco.Agent, name string) disco.Watcher {
+	svc, err := agent.Service(ctx, name)
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	return svc.Watch()
+}
+
+func next(t *testing.T, w disco.Watcher) []*disco.Event {
+	type result struct {
+		events []*disco.Event
+		err    error
+	}
+	c := make(chan result, 1)
+	go func() {
+		events, err := w.Next()
+		c <- result{events: events, err: err}
+	}()
+
+	select {
+	case r := <-c:
+		if r.err != nil {
+			t.Fatal("expect to get an update", r.err)
+		}
+		return r.events
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect to get an update before timeout")
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+// Package serf is a service discovery adapter built on the Hashicorp Serf
+// gossip protocol (SWIM), for small deployments which do not run Consul.
+//
+// Each node runs a member of the same cluster, and advertises the services it
+// offers as member tags. Serf tags are limited to 512 bytes per member, which
+// bounds the number of services a node can register.
+//
+// When a node fails, it is eventually detected by the other members, and all
+// its instances are deleted.
+package serf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/memberlist"
+	hs "github.com/hashicorp/serf/serf"
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/config"
+	"github.com/stairlin/lego/ctx"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/disco/adapter/internal/watch"
+	"github.com/stairlin/lego/log"
+)
+
+// Name contains the adapter registered name
+const Name = "serf"
+
+const (
+	// DefaultBindPort is the default port on which members gossip
+	DefaultBindPort = 7946
+
+	// svcTagPrefix is the member tag prefix of registered services
+	svcTagPrefix = "s:"
+	// dcTag is the member tag which holds the member datacenter
+	dcTag = "dc"
+)
+
+// Config contains the configuration to start a service discovery agent
+type Config struct {
+	// NodeName is the unique name of the node (default: hostname)
+	NodeName string `toml:"node_name"`
+	// BindAddr is the address on which members gossip (default: 0.0.0.0)
+	BindAddr string `toml:"bind_addr"`
+	// BindPort is the port on which members gossip (default: 7946)
+	BindPort int `toml:"bind_port"`
+	// AdvertiseAddr is the address advertised to other members (optional)
+	AdvertiseAddr string `toml:"advertise_addr"`
+	// AdvertisePort is the port advertised to other members (optional)
+	AdvertisePort int `toml:"advertise_port"`
+	// Join contains seed addresses of existing members (host:port)
+	Join []string `toml:"join"`
+	// Profile sets the gossip timings, either "lan" (default), "wan" or "local"
+	Profile string `toml:"profile"`
+	// EncryptKey is a base64 encoded key to encrypt gossip messages (optional)
+	EncryptKey string `toml:"encrypt_key"`
+	// DC is the datacenter of the node
+	DC          string   `toml:"dc"`
+	DefaultTags []string `toml:"default_tags"`
+}
+
+// New returns a new serf agent which joins the cluster
+func New(tree config.Tree) (disco.Agent, error) {
+	config := &Config{}
+	if err := tree.Unmarshal(config); err != nil {
+		return nil, err
+	}
+	return Start(config)
+}
+
+// Start starts a new serf agent with the given config
+func Start(config *Config) (*Agent, error) {
+	mc, err := memberlistConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan hs.Event, 64)
+	sc := hs.DefaultConfig()
+	sc.NodeName = mc.Name
+	sc.MemberlistConfig = mc
+	sc.EventCh = events
+	sc.LogOutput = ioutil.Discard
+	sc.Tags = map[string]string{}
+	if config.DC != "" {
+		sc.Tags[dcTag] = config.DC
+	}
+
+	a := &Agent{
+		config: config,
+		regs:   map[string]*record{},
+	}
+	a.set = watch.New(config.DC, a.instances)
+	a.serf, err = hs.Create(sc)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create serf agent")
+	}
+	go a.listen(events)
+
+	if len(config.Join) > 0 {
+		if _, err := a.serf.Join(config.Join, true); err != nil {
+			a.serf.Shutdown()
+			return nil, errors.Wrap(err, "cannot join cluster")
+		}
+	}
+	return a, nil
+}
+
+func memberlistConfig(config *Config) (*memberlist.Config, error) {
+	var mc *memberlist.Config
+	switch config.Profile {
+	case "", "lan":
+		mc = memberlist.DefaultLANConfig()
+	case "wan":
+		mc = memberlist.DefaultWANConfig()
+	case "local":
+		mc = memberlist.DefaultLocalConfig()
+	default:
+		return nil, errors.Errorf("unknown serf profile <%s>", config.Profile)
+	}
+
+	mc.LogOutput = ioutil.Discard
+	mc.Name = config.NodeName
+	if mc.Name == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get node name")
+		}
+		mc.Name = host
+	}
+	if config.BindAddr != "" {
+		mc.BindAddr = config.BindAddr
+	}
+	mc.BindPort = DefaultBindPort
+	if config.BindPort != 0 {
+		mc.BindPort = config.BindPort
+	}
+	mc.AdvertiseAddr = config.AdvertiseAddr
+	mc.AdvertisePort = mc.BindPort
+	if config.AdvertisePort != 0 {
+		mc.AdvertisePort = config.AdvertisePort
+	}
+	if config.EncryptKey != "" {
+		key, err := base64.StdEncoding.DecodeString(config.EncryptKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode serf encryption key")
+		}
+		mc.SecretKey = key
+	}
+	return mc, nil
+}
+
+// Agent implements disco.Agent
+type Agent struct {
+	mu sync.Mutex
+
+	serf   *hs.Serf
+	config *Config
+
+	// regs contains all services registered by this agent
+	regs map[string]*record
+	// set is notified whenever the cluster state changes
+	set *watch.Set
+}
+
+// record is the value of a service member tag
+type record struct {
+	Name   string            `json:"n"`
+	Host   string            `json:"h"`
+	Port   uint16            `json:"p"`
+	Tags   []string          `json:"t,omitempty"`
+	Meta   map[string]string `json:"m,omitempty"`
+	Weight int               `json:"w,omitempty"`
+}
+
+func (a *Agent) Register(ctx ctx.Ctx, r *disco.Registration) (string, error) {
+	id := r.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	rec := &record{
+		Name:   r.Name,
+		Host:   r.Addr,
+		Port:   r.Port,
+		Tags:   append(a.config.DefaultTags, r.Tags...),
+		Meta:   r.Meta,
+		Weight: r.Weight,
+	}
+
+	ctx.Trace("disco.register", "Register service",
+		log.String("adapter", Name),
+		log.String("service_name", rec.Name),
+		log.String("instance_id", id),
+		log.String("instance_address", rec.Host),
+		log.Uint("instance_port", uint(rec.Port)),
+		log.String("instance_tags", strings.Join(rec.Tags, ", ")),
+	)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	prev, ok := a.regs[id]
+	a.regs[id] = rec
+	if err := a.advertise(); err != nil {
+		if ok {
+			a.regs[id] = prev
+		} else {
+			delete(a.regs, id)
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+func (a *Agent) Deregister(ctx ctx.Ctx, id string) error {
+	ctx.Trace("disco.deregister", "Deregister service",
+		log.String("id", id),
+		log.String("adapter", Name),
+	)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.regs[id]; !ok {
+		return nil
+	}
+	delete(a.regs, id)
+	return a.advertise()
+}
+
+func (a *Agent) Services(
+	ctx ctx.Ctx, tags ...string,
+) (map[string]disco.Service, error) {
+	return a.set.Services(tags...), nil
+}
+
+func (a *Agent) Service(
+	ctx ctx.Ctx, name string, o ...disco.ServiceOption,
+) (disco.Service, error) {
+	return a.set.Service(name, o...), nil
+}
+
+// Leave de-registers all services, and then gracefully leaves the cluster
+func (a *Agent) Leave(ctx ctx.Ctx) {
+	a.mu.Lock()
+	a.regs = map[string]*record{}
+	if err := a.advertise(); err != nil {
+		ctx.Warning("disco.leave.failure", "Could not de-register services",
+			log.Error(err),
+		)
+	}
+	a.mu.Unlock()
+
+	if err := a.serf.Leave(); err != nil {
+		ctx.Warning("disco.leave.failure", "Could not leave cluster",
+			log.Error(err),
+		)
+	}
+	a.serf.Shutdown()
+}
+
+// Shutdown stops the agent without leaving the cluster. Other members will
+// consider this node as failed.
+func (a *Agent) Shutdown() error {
+	return a.serf.Shutdown()
+}
+
+// advertise updates the member tags with the registered services
+func (a *Agent) advertise() error {
+	tags := map[string]string{}
+	if a.config.DC != "" {
+		tags[dcTag] = a.config.DC
+	}
+	for id, rec := range a.regs {
+		v, err := json.Marshal(rec)
+		if err != nil {
+			return errors.Wrap(err, "cannot encode service")
+		}
+		tags[svcTagPrefix+id] = string(v)
+	}
+	if err := a.serf.SetTags(tags); err != nil {
+		return errors.Wrap(err, "cannot advertise services")
+	}
+	a.set.Notify()
+	return nil
+}
+
+// listen waits for cluster events until the agent shuts down
+func (a *Agent) listen(events <-chan hs.Event) {
+	for {
+		select {
+		case <-a.serf.ShutdownCh():
+			a.set.Close()
+			return
+		case e := <-events:
+			if _, ok := e.(hs.MemberEvent); ok {
+				a.set.Notify()
+			}
+		}
+	}
+}
+
+// instances returns the instances offered by alive members. When name is
+// empty, instances of all services are returned.
+func (a *Agent) instances(name string) []*disco.Instance {
+	local := a.serf.LocalMember().Name
+	var instances []*disco.Instance
+	for _, m := range a.serf.Members() {
+		if m.Status != hs.StatusAlive {
+			continue
+		}
+		for k, v := range m.Tags {
+			if !strings.HasPrefix(k, svcTagPrefix) {
+				continue
+			}
+			rec := &record{}
+			if err := json.Unmarshal([]byte(v), rec); err != nil {
+				continue
+			}
+			if name != "" && rec.Name != name {
+				continue
+			}
+
+			i := &disco.Instance{
+				Local:  m.Name == local,
+				ID:     strings.TrimPrefix(k, svcTagPrefix),
+				Name:   rec.Name,
+				Host:   rec.Host,
+				Port:   rec.Port,
+				Tags:   rec.Tags,
+				Meta:   rec.Meta,
+				DC:     m.Tags[dcTag],
+				Weight: rec.Weight,
+			}
+			if i.Host == "" {
+				i.Host = m.Addr.String()
+			}
+			if i.Weight <= 0 {
+				i.Weight = 1
+			}
+			instances = append(instances, i)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
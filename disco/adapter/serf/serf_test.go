@@ -0,0 +1,146 @@
+package serf_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/disco/adapter/serf"
+	lt "github.com/stairlin/lego/testing"
+)
+
+// TestCluster runs three agents on loopback ports, and checks that they see
+// each other services, including when a node fails
+func TestCluster(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("serf-test")
+
+	var agents []*serf.Agent
+	var seed string
+	for i := 0; i < 3; i++ {
+		port := freePort(t)
+		c := &serf.Config{
+			NodeName: fmt.Sprintf("node-%d", i),
+			BindAddr: "127.0.0.1",
+			BindPort: port,
+			Profile:  "local",
+			DC:       "test",
+		}
+		if seed != "" {
+			c.Join = []string{seed}
+		} else {
+			seed = fmt.Sprintf("127.0.0.1:%d", port)
+		}
+		a, err := serf.Start(c)
+		if err != nil {
+			t.Fatal("expect to be able to start agent", err)
+		}
+		defer a.Shutdown()
+		agents = append(agents, a)
+
+		_, err = a.Register(ctx, &disco.Registration{
+			ID:   fmt.Sprintf("api-%d", i),
+			Name: "api.http",
+			Addr: "127.0.0.1",
+			Port: uint16(3000 + i),
+			Meta: map[string]string{"node": c.NodeName},
+		})
+		if err != nil {
+			t.Fatal("expect to be able to register service", err)
+		}
+	}
+
+	svc, err := agents[0].Service(ctx, "api.http")
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	w := svc.Watch()
+	defer w.Close()
+
+	// Wait for all instances to be gossiped
+	instances := map[string]*disco.Instance{}
+	for _, i := range svc.Instances() {
+		instances[i.ID] = i
+	}
+	for _, e := range next(t, w) {
+		instances[e.Instance.ID] = e.Instance
+	}
+	waitFor(t, w, func(events []*disco.Event) bool {
+		for _, e := range events {
+			instances[e.Instance.ID] = e.Instance
+		}
+		return len(instances) == 3
+	})
+	if !instances["api-0"].Local || instances["api-1"].Local {
+		t.Error("expect only instances of the local node to be local")
+	}
+	if instances["api-2"].Meta["node"] != "node-2" || instances["api-2"].DC != "test" {
+		t.Errorf("expect instance metadata to be gossiped, but got %+v", instances["api-2"])
+	}
+
+	// Simulate a node failure
+	agents[2].Shutdown()
+	waitFor(t, w, func(events []*disco.Event) bool {
+		for _, e := range events {
+			if e.Op == disco.Delete && e.Instance.ID == "api-2" {
+				return true
+			}
+		}
+		return false
+	})
+
+	// Gracefully leave
+	agents[1].Leave(ctx)
+	waitFor(t, w, func(events []*disco.Event) bool {
+		for _, e := range events {
+			if e.Op == disco.Delete && e.Instance.ID == "api-1" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func next(t *testing.T, w disco.Watcher) []*disco.Event {
+	events, err := w.Next()
+	if err != nil {
+		t.Fatal("expect to get watcher events", err)
+	}
+	return events
+}
+
+// waitFor reads events until f returns true
+func waitFor(t *testing.T, w disco.Watcher, f func([]*disco.Event) bool) {
+	done := make(chan struct{})
+	timeout := time.AfterFunc(20*time.Second, func() {
+		close(done)
+		w.Close()
+	})
+	defer timeout.Stop()
+
+	for {
+		events, err := w.Next()
+		if err != nil {
+			select {
+			case <-done:
+				t.Fatal("expect condition to be met before timeout")
+			default:
+				t.Fatal("expect to get watcher events", err)
+			}
+		}
+		if f(events) {
+			return
+		}
+	}
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
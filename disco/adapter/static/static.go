@@ -0,0 +1,332 @@
+// Package static is a service discovery adapter backed by a static list of
+// instances, for local development and staging environments.
+//
+// Instances are either listed in the config tree, or in a JSON/TOML file
+// which is polled for changes. Editing the file updates the watchers of the
+// services it contains.
+//
+//	[disco.static]
+//	file = "services.toml"
+//
+//	[[disco.static.services]]
+//	name = "api.http"
+//	host = "127.0.0.1"
+//	port = 3000
+//
+// Services registered by the application itself are only known to the agent
+// which registered them.
+package static
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/config"
+	"github.com/stairlin/lego/ctx"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/disco/adapter/internal/watch"
+	"github.com/stairlin/lego/log"
+)
+
+// Name contains the adapter registered name
+const Name = "static"
+
+// DefaultPollInterval is the default interval at which the file is checked
+// for changes
+const DefaultPollInterval = time.Second
+
+// Config contains the configuration to start a service discovery agent
+type Config struct {
+	// Services contains the instances listed in the config tree
+	Services []Entry `toml:"services"`
+	// File is the path of a JSON or TOML file listing instances (optional)
+	File string `toml:"file"`
+	// PollIntervalMS is the interval at which the file is checked for changes
+	PollIntervalMS int `toml:"poll_interval_ms"`
+	// DC is the datacenter of the node
+	DC          string   `toml:"dc"`
+	DefaultTags []string `toml:"default_tags"`
+}
+
+// Entry is a statically defined service instance
+type Entry struct {
+	// ID is the instance identifier (default: <name>-<host>:<port>)
+	ID     string            `toml:"id" json:"id"`
+	Name   string            `toml:"name" json:"name"`
+	Host   string            `toml:"host" json:"host"`
+	Port   uint16            `toml:"port" json:"port"`
+	Tags   []string          `toml:"tags" json:"tags"`
+	Meta   map[string]string `toml:"meta" json:"meta"`
+	DC     string            `toml:"dc" json:"dc"`
+	Weight int               `toml:"weight" json:"weight"`
+}
+
+// file is the content of a service file
+type file struct {
+	Services []Entry `toml:"services" json:"services"`
+}
+
+// New returns a new static agent
+func New(tree config.Tree) (disco.Agent, error) {
+	config := &Config{}
+	if err := tree.Unmarshal(config); err != nil {
+		return nil, err
+	}
+	return Start(config)
+}
+
+// Start starts a new static agent with the given config. When a file is
+// configured, it is loaded and then polled until the agent leaves.
+func Start(config *Config) (*Agent, error) {
+	a := &Agent{
+		config: config,
+		regs:   map[string]*disco.Instance{},
+		done:   make(chan struct{}),
+	}
+	a.set = watch.New(config.DC, a.instances)
+	if config.File == "" {
+		return a, nil
+	}
+
+	fi, err := os.Stat(config.File)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot stat service file")
+	}
+	entries, err := load(config.File)
+	if err != nil {
+		return nil, err
+	}
+	a.file = entries
+
+	interval := DefaultPollInterval
+	if config.PollIntervalMS > 0 {
+		interval = time.Duration(config.PollIntervalMS) * time.Millisecond
+	}
+	go a.poll(interval, fi)
+	return a, nil
+}
+
+// Agent implements disco.Agent
+type Agent struct {
+	mu sync.Mutex
+
+	config *Config
+	// file contains the instances loaded from the service file
+	file []Entry
+	// regs contains all services registered by this agent
+	regs map[string]*disco.Instance
+	// set is notified whenever the instances change
+	set *watch.Set
+
+	once sync.Once
+	done chan struct{}
+}
+
+func (a *Agent) Register(ctx ctx.Ctx, r *disco.Registration) (string, error) {
+	i := &disco.Instance{
+		Local:  true,
+		ID:     r.ID,
+		Name:   r.Name,
+		Host:   r.Addr,
+		Port:   r.Port,
+		Tags:   append(a.config.DefaultTags, r.Tags...),
+		Meta:   r.Meta,
+		DC:     a.config.DC,
+		Weight: r.Weight,
+	}
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	if i.Weight <= 0 {
+		i.Weight = 1
+	}
+
+	ctx.Trace("disco.register", "Register service",
+		log.String("adapter", Name),
+		log.String("service_name", i.Name),
+		log.String("instance_id", i.ID),
+		log.String("instance_address", i.Host),
+		log.Uint("instance_port", uint(i.Port)),
+		log.String("instance_tags", strings.Join(i.Tags, ", ")),
+	)
+
+	a.mu.Lock()
+	a.regs[i.ID] = i
+	a.mu.Unlock()
+	a.set.Notify()
+	return i.ID, nil
+}
+
+func (a *Agent) Deregister(ctx ctx.Ctx, id string) error {
+	ctx.Trace("disco.deregister", "Deregister service",
+		log.String("id", id),
+		log.String("adapter", Name),
+	)
+
+	a.mu.Lock()
+	_, ok := a.regs[id]
+	delete(a.regs, id)
+	a.mu.Unlock()
+	if ok {
+		a.set.Notify()
+	}
+	return nil
+}
+
+func (a *Agent) Services(
+	ctx ctx.Ctx, tags ...string,
+) (map[string]disco.Service, error) {
+	return a.set.Services(tags...), nil
+}
+
+func (a *Agent) Service(
+	ctx ctx.Ctx, name string, o ...disco.ServiceOption,
+) (disco.Service, error) {
+	return a.set.Service(name, o...), nil
+}
+
+// Leave de-registers all services, and then stops polling the service file
+func (a *Agent) Leave(ctx ctx.Ctx) {
+	a.mu.Lock()
+	a.regs = map[string]*disco.Instance{}
+	a.mu.Unlock()
+	a.set.Notify()
+	a.set.Close()
+
+	a.once.Do(func() {
+		close(a.done)
+	})
+}
+
+// poll reloads the service file whenever its size or modification time
+// changes. A file which cannot be parsed is ignored until it is fixed.
+func (a *Agent) poll(interval time.Duration, last os.FileInfo) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(a.config.File)
+		if err != nil {
+			continue
+		}
+		if fi.Size() == last.Size() && fi.ModTime().Equal(last.ModTime()) {
+			continue
+		}
+		entries, err := load(a.config.File)
+		if err != nil {
+			continue
+		}
+		last = fi
+
+		a.mu.Lock()
+		a.file = entries
+		a.mu.Unlock()
+		a.set.Notify()
+	}
+}
+
+// instances returns the static and registered instances. When name is empty,
+// instances of all services are returned.
+func (a *Agent) instances(name string) []*disco.Instance {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	m := map[string]*disco.Instance{}
+	for _, e := range a.config.Services {
+		i := a.instance(e)
+		m[i.ID] = i
+	}
+	for _, e := range a.file {
+		i := a.instance(e)
+		m[i.ID] = i
+	}
+	for id, i := range a.regs {
+		m[id] = i
+	}
+
+	instances := make([]*disco.Instance, 0, len(m))
+	for _, i := range m {
+		if name != "" && i.Name != name {
+			continue
+		}
+		instances = append(instances, i)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
+
+// instance converts a static entry to an instance
+func (a *Agent) instance(e Entry) *disco.Instance {
+	i := &disco.Instance{
+		ID:     e.ID,
+		Name:   e.Name,
+		Host:   e.Host,
+		Port:   e.Port,
+		Tags:   e.Tags,
+		Meta:   e.Meta,
+		DC:     e.DC,
+		Weight: e.Weight,
+	}
+	if i.ID == "" {
+		i.ID = fmt.Sprintf("%s-%s", e.Name, i.Addr())
+	}
+	if i.DC == "" {
+		i.DC = a.config.DC
+	}
+	if i.Weight <= 0 {
+		i.Weight = 1
+	}
+	return i
+}
+
+// load reads the entries of a service file. The format is picked from the
+// file extension, either .json or .toml.
+func load(path string) ([]Entry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read service file")
+	}
+
+	f := &file{}
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, errors.Wrap(err, "cannot decode service file")
+		}
+	case ".toml":
+		tree, err := config.LoadTree(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := tree.Unmarshal(f); err != nil {
+			return nil, errors.Wrap(err, "cannot decode service file")
+		}
+	default:
+		return nil, errors.Errorf("unsupported service file format <%s>", ext)
+	}
+
+	for _, e := range f.Services {
+		if e.Name == "" {
+			return nil, errors.New("missing service name in service file")
+		}
+	}
+	return f.Services, nil
+}
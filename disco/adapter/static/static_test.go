@@ -0,0 +1,278 @@
+package static_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/config"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/disco/adapter/static"
+	lt "github.com/stairlin/lego/testing"
+)
+
+func TestConfigServices(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("static-test")
+
+	tree, err := config.LoadTree(strings.NewReader(`
+dc = "eu"
+
+[[services]]
+name = "api.http"
+host = "10.0.0.1"
+port = 3000
+tags = ["v1"]
+weight = 2
+
+[services.meta]
+az = "1"
+
+[[services]]
+id = "api-2"
+name = "api.http"
+host = "10.0.0.2"
+port = 3000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := static.New(tree)
+	if err != nil {
+		t.Fatal("cannot create agent", err)
+	}
+	defer agent.Leave(ctx)
+
+	svc, err := agent.Service(ctx, "api.http")
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	instances := svc.Instances()
+	if len(instances) != 2 {
+		t.Fatalf("expect 2 instances, but got %d", len(instances))
+	}
+	i := instances[1]
+	if i.ID != "api.http-10.0.0.1:3000" || i.Local || i.DC != "eu" {
+		t.Errorf("expect instance to be loaded from config, but got %+v", i)
+	}
+	if i.Meta["az"] != "1" || i.Weight != 2 {
+		t.Errorf("expect instance metadata to be loaded, but got %+v", i)
+	}
+	if instances[0].ID != "api-2" || instances[0].Weight != 1 {
+		t.Errorf("expect instance to be loaded from config, but got %+v", instances[0])
+	}
+
+	id, err := agent.Register(ctx, &disco.Registration{
+		Name: "api.http",
+		Addr: "127.0.0.1",
+		Port: 3001,
+		Tags: []string{"v1"},
+	})
+	if err != nil {
+		t.Fatal("expect to be able to register service", err)
+	}
+	svcs, err := agent.Services(ctx, "v1")
+	if err != nil {
+		t.Fatal("expect to be able to list services", err)
+	}
+	if n := len(svcs["api.http"].Instances()); n != 2 {
+		t.Errorf("expect 2 instances tagged v1, but got %d", n)
+	}
+
+	if err := agent.Deregister(ctx, id); err != nil {
+		t.Fatal("expect to be able to deregister service", err)
+	}
+	svc, _ = agent.Service(ctx, "api.http", disco.WithTags("v1"))
+	if n := len(svc.Instances()); n != 1 {
+		t.Errorf("expect 1 instance tagged v1, but got %d", n)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	tests := []struct {
+		ext   string
+		one   string
+		two   string
+		empty string
+	}{
+		{
+			ext:   ".json",
+			one:   `{"services":[{"id":"a","name":"api.http","host":"10.0.0.1","port":3000}]}`,
+			two:   `{"services":[{"id":"b","name":"api.http","host":"10.0.0.2","port":3000}]}`,
+			empty: `{"services":[]}`,
+		},
+		{
+			ext:   ".toml",
+			one:   "[[services]]\nid = \"a\"\nname = \"api.http\"\nhost = \"10.0.0.1\"\nport = 3000\n",
+			two:   "[[services]]\nid = \"b\"\nname = \"api.http\"\nhost = \"10.0.0.2\"\nport = 3000\n",
+			empty: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ext, func(t *testing.T) {
+			tt := lt.New(t)
+			ctx := tt.NewAppCtx("static-test")
+
+			dir, err := ioutil.TempDir("", "lego-static")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "services"+test.ext)
+			write(t, path, test.one)
+
+			agent, err := static.Start(&static.Config{File: path, PollIntervalMS: 10})
+			if err != nil {
+				t.Fatal("cannot create agent", err)
+			}
+			svc, err := agent.Service(ctx, "api.http")
+			if err != nil {
+				t.Fatal("expect to be able to get service", err)
+			}
+			w := svc.Watch()
+			defer w.Close()
+
+			expect(t, w, disco.Add, "a")
+
+			write(t, path, test.two)
+			events := next(t, w)
+			if len(events) != 2 {
+				t.Fatalf("expect 2 events, but got %d", len(events))
+			}
+			if events[0].Op != disco.Add || events[0].Instance.ID != "b" {
+				t.Errorf("expect b to be added, but got %v", events[0])
+			}
+			if events[1].Op != disco.Delete || events[1].Instance.ID != "a" {
+				t.Errorf("expect a to be deleted, but got %v", events[1])
+			}
+
+			// Invalid files are ignored
+			write(t, path, "{{")
+			write(t, path, test.empty)
+			expect(t, w, disco.Delete, "b")
+
+			agent.Leave(ctx)
+			if _, err := w.Next(); err != disco.ErrWatcherClosed {
+				t.Errorf("expect watcher to be closed, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestWatchFileEntry(t *testing.T) {
+	tt := lt.New(t)
+	ctx := tt.NewAppCtx("static-test")
+
+	dir, err := ioutil.TempDir("", "lego-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+	write(t, path, `{"services":[
+		{"id":"a","name":"api.http","host":"10.0.0.1","port":3000},
+		{"id":"b","name":"api.http","host":"10.0.0.2","port":3000}
+	]}`)
+
+	agent, err := static.Start(&static.Config{File: path, PollIntervalMS: 10})
+	if err != nil {
+		t.Fatal("cannot create agent", err)
+	}
+	defer agent.Leave(ctx)
+	svc, err := agent.Service(ctx, "api.http")
+	if err != nil {
+		t.Fatal("expect to be able to get service", err)
+	}
+	w := svc.Watch()
+	defer w.Close()
+	if events := next(t, w); len(events) != 2 {
+		t.Fatalf("expect a snapshot with 2 instances, but got %v", events)
+	}
+
+	// Only the edited entry is updated
+	write(t, path, `{"services":[
+		{"id":"a","name":"api.http","host":"10.0.0.1","port":3000},
+		{"id":"b","name":"api.http","host":"10.0.0.2","port":3001}
+	]}`)
+	expect(t, w, disco.Update, "b")
+
+	// Other services do not update the instances
+	_, err = agent.Register(ctx, &disco.Registration{
+		ID: "c", Name: "api.grpc", Addr: "127.0.0.1", Port: 4000,
+	})
+	if err != nil {
+		t.Fatal("expect to be able to register service", err)
+	}
+	_, err = agent.Register(ctx, &disco.Registration{
+		ID: "d", Name: "api.http", Addr: "127.0.0.1", Port: 3000,
+	})
+	if err != nil {
+		t.Fatal("expect to be able to register service", err)
+	}
+	expect(t, w, disco.Add, "d")
+}
+
+func TestInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"services.yaml": "services: []",
+		"services.json": `{"services":[{"host":"10.0.0.1"}]}`,
+		"missing.json":  "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if content != "" {
+			write(t, path, content)
+		}
+		if _, err := static.Start(&static.Config{File: path}); err == nil {
+			t.Errorf("expect %s to be rejected", name)
+		}
+	}
+}
+
+func write(t *testing.T, path, content string) {
+	// Make sure the modification time changes on coarse file systems
+	time.Sleep(20 * time.Millisecond)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func next(t *testing.T, w disco.Watcher) []*disco.Event {
+	type result struct {
+		events []*disco.Event
+		err    error
+	}
+	c := make(chan result, 1)
+	go func() {
+		events, err := w.Next()
+		c <- result{events: events, err: err}
+	}()
+
+	select {
+	case r := <-c:
+		if r.err != nil {
+			t.Fatal("expect to get an update", r.err)
+		}
+		return r.events
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect to get an update before timeout")
+	}
+	return nil
+}
+
+func expect(t *testing.T, w disco.Watcher, op disco.Operation, id string) {
+	events := next(t, w)
+	if len(events) != 1 || events[0].Op != op || events[0].Instance.ID != id {
+		t.Errorf("expect %s to get op %d, but got %v", id, op, events)
+	}
+}
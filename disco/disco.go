@@ -19,7 +19,7 @@ type Agent interface {
 	// Services returns all registered service instances
 	Services(ctx ctx.Ctx, tags ...string) (map[string]Service, error)
 	// Service returns all instances of a service
-	Service(ctx ctx.Ctx, name string, tags ...string) (Service, error)
+	Service(ctx ctx.Ctx, name string, o ...ServiceOption) (Service, error)
 	// Leave is used to have the agent de-register all services from the catalogue
 	// that belong to this node, and gracefully leave
 	Leave(ctx ctx.Ctx)
@@ -52,6 +52,15 @@ type Instance struct {
 	Port uint16
 	// Tags of that instance
 	Tags []string
+	// Meta contains arbitrary key/value pairs attached to that instance
+	Meta map[string]string
+	// Health is the aggregated status of the instance health checks
+	Health HealthStatus
+	// DC is the datacenter in which the instance runs
+	DC string
+	// Weight is the relative amount of traffic the instance should receive
+	// compared to other instances (default 1)
+	Weight int
 }
 
 // Addr returns the instance host+port
@@ -68,4 +77,34 @@ type Registration struct {
 	Addr string
 	Port uint16
 	Tags []string
+	// Meta contains arbitrary key/value pairs (optional)
+	Meta map[string]string
+	// Weight is the relative amount of traffic the service should receive
+	// (optional)
+	Weight int
+}
+
+// HealthStatus is the status of an instance health checks
+type HealthStatus uint8
+
+const (
+	// Passing instances are healthy
+	Passing HealthStatus = iota
+	// Warning instances are still able to serve requests
+	Warning
+	// Critical instances should not receive any request
+	Critical
+)
+
+func (h HealthStatus) String() string {
+	switch h {
+	case Passing:
+		return "passing"
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	default:
+		return "unknown"
+	}
 }
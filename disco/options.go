@@ -0,0 +1,109 @@
+package disco
+
+// ServiceOption configures how we query a service
+type ServiceOption func(*ServiceOptions)
+
+// ServiceOptions configure a service query. ServiceOptions are set by the
+// ServiceOption values passed to Service.
+type ServiceOptions struct {
+	Tags          []string
+	Passing       bool
+	Meta          map[string]string
+	PreferLocalDC bool
+}
+
+// BuildServiceOptions returns the service options built from o. Only
+// instances with passing health checks are returned by default.
+func BuildServiceOptions(o ...ServiceOption) *ServiceOptions {
+	opts := &ServiceOptions{Passing: true}
+	for _, o := range o {
+		o(opts)
+	}
+	return opts
+}
+
+// WithTags only returns instances which have all the given tags
+func WithTags(tags ...string) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.Tags = append(o.Tags, tags...)
+	}
+}
+
+// OnlyPassing only returns instances with passing health checks
+func OnlyPassing() ServiceOption {
+	return func(o *ServiceOptions) {
+		o.Passing = true
+	}
+}
+
+// AnyHealth returns instances regardless of their health checks
+func AnyHealth() ServiceOption {
+	return func(o *ServiceOptions) {
+		o.Passing = false
+	}
+}
+
+// WithMeta only returns instances which have the given metadata
+func WithMeta(key, value string) ServiceOption {
+	return func(o *ServiceOptions) {
+		if o.Meta == nil {
+			o.Meta = map[string]string{}
+		}
+		o.Meta[key] = value
+	}
+}
+
+// PreferLocalDC only returns instances of the local datacenter, unless there
+// are none of them. In that case, instances of other datacenters are returned.
+func PreferLocalDC() ServiceOption {
+	return func(o *ServiceOptions) {
+		o.PreferLocalDC = true
+	}
+}
+
+// Match returns whether the instance matches the tags, health and metadata
+// options
+func (o *ServiceOptions) Match(i *Instance) bool {
+	if o.Passing && i.Health != Passing {
+		return false
+	}
+	for k, v := range o.Meta {
+		if mv, ok := i.Meta[k]; !ok || mv != v {
+			return false
+		}
+	}
+	for _, tag := range o.Tags {
+		if !hasTag(i.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the instances which match the options. localDC is the
+// datacenter in which the agent runs.
+func (o *ServiceOptions) Filter(l []*Instance, localDC string) []*Instance {
+	var all, local []*Instance
+	for _, i := range l {
+		if !o.Match(i) {
+			continue
+		}
+		all = append(all, i)
+		if i.DC == localDC {
+			local = append(local, i)
+		}
+	}
+	if o.PreferLocalDC && len(local) > 0 {
+		return local
+	}
+	return all
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package disco_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stairlin/lego/disco"
+)
+
+func TestServiceOptionsFilter(t *testing.T) {
+	a := &disco.Instance{ID: "a", DC: "eu", Tags: []string{"v1"}}
+	b := &disco.Instance{ID: "b", DC: "eu", Health: disco.Warning}
+	c := &disco.Instance{ID: "c", DC: "us", Meta: map[string]string{"az": "1"}}
+	all := []*disco.Instance{a, b, c}
+
+	tests := []struct {
+		name   string
+		opts   []disco.ServiceOption
+		dc     string
+		expect []*disco.Instance
+	}{
+		{name: "none", expect: []*disco.Instance{a, c}},
+		{name: "tags", opts: []disco.ServiceOption{disco.WithTags("v1")}, expect: []*disco.Instance{a}},
+		{name: "passing", opts: []disco.ServiceOption{disco.OnlyPassing()}, expect: []*disco.Instance{a, c}},
+		{name: "any health", opts: []disco.ServiceOption{disco.AnyHealth()}, expect: all},
+		{name: "meta", opts: []disco.ServiceOption{disco.WithMeta("az", "1")}, expect: []*disco.Instance{c}},
+		{name: "local dc", opts: []disco.ServiceOption{disco.PreferLocalDC(), disco.AnyHealth()}, dc: "eu", expect: []*disco.Instance{a, b}},
+		{name: "remote dc", opts: []disco.ServiceOption{disco.PreferLocalDC(), disco.AnyHealth()}, dc: "ap", expect: all},
+		{
+			name:   "local dc fallback",
+			opts:   []disco.ServiceOption{disco.PreferLocalDC(), disco.WithMeta("az", "1")},
+			dc:     "eu",
+			expect: []*disco.Instance{c},
+		},
+	}
+
+	for _, test := range tests {
+		got := disco.BuildServiceOptions(test.opts...).Filter(all, test.dc)
+		if !reflect.DeepEqual(test.expect, got) {
+			t.Errorf("%s: expect %v, but got %v", test.name, test.expect, got)
+		}
+	}
+}
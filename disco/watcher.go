@@ -2,6 +2,7 @@ package disco
 
 import (
 	"errors"
+	"reflect"
 )
 
 // Watcher watches for the updates on the specified service
@@ -45,7 +46,8 @@ type Diff struct {
 	m map[string]*Instance
 }
 
-// Apply returns all events needed to go from the current state to the new state
+// Apply returns all events needed to go from the current state to the new state.
+// Instances which have not changed are not updated.
 func (d *Diff) Apply(state []*Instance) (events []*Event) {
 	if d.m == nil {
 		d.m = map[string]*Instance{}
@@ -56,13 +58,12 @@ func (d *Diff) Apply(state []*Instance) (events []*Event) {
 	for _, inst := range state {
 		running[inst.ID] = struct{}{}
 
-		if _, ok := d.m[inst.ID]; !ok {
+		if prev, ok := d.m[inst.ID]; !ok {
 			events = append(events, &Event{
 				Op:       Add,
 				Instance: inst,
 			})
-		} else {
-			// TODO: Check if it needs an update (optimisation)
+		} else if !reflect.DeepEqual(prev, inst) {
 			events = append(events, &Event{
 				Op:       Update,
 				Instance: inst,
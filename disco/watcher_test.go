@@ -46,10 +46,6 @@ func TestDiff(t *testing.T) {
 		},
 	}
 	expect = []*disco.Event{
-		&disco.Event{
-			Op:       disco.Update,
-			Instance: b[0], // TODO: Remove once diff tests when updates are needed
-		},
 		&disco.Event{
 			Op:       disco.Add,
 			Instance: b[1],
@@ -71,10 +67,6 @@ func TestDiff(t *testing.T) {
 		},
 	}
 	expect = []*disco.Event{
-		&disco.Event{
-			Op:       disco.Update,
-			Instance: c[0], // TODO: Remove once diff tests when updates are needed
-		},
 		&disco.Event{
 			Op: disco.Delete,
 			Instance: &disco.Instance{
@@ -110,3 +102,20 @@ func TestDiff(t *testing.T) {
 		t.Errorf("expect state D to be %v, but got %v", expect, res)
 	}
 }
+
+func TestDiffUnchanged(t *testing.T) {
+	diff := disco.Diff{}
+	diff.Apply([]*disco.Instance{
+		{ID: "alpha", Port: 1001, Tags: []string{"v1"}},
+		{ID: "beta", Port: 1002},
+	})
+
+	// Instances are compared by content
+	res := diff.Apply([]*disco.Instance{
+		{ID: "alpha", Port: 1001, Tags: []string{"v1"}},
+		{ID: "beta", Port: 1003},
+	})
+	if len(res) != 1 || res[0].Op != disco.Update || res[0].Instance.ID != "beta" {
+		t.Errorf("expect only beta to be updated, but got %v", res)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/stairlin/lego"
 	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/disco"
 	"github.com/stairlin/lego/net/http"
 )
 
@@ -47,7 +48,7 @@ func main() {
 	})
 
 	// Listen to service discovery events for that service
-	svc, err := app.Disco().Service(app.Ctx(), "api.http", tags...)
+	svc, err := app.Disco().Service(app.Ctx(), "api.http", disco.WithTags(tags...))
 	if err != nil {
 		fmt.Println("Problem getting service", err)
 		os.Exit(1)
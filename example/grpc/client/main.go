@@ -10,7 +10,6 @@ import (
 	"github.com/stairlin/lego/ctx/journey"
 	"github.com/stairlin/lego/example/grpc/server/demo"
 	lgrpc "github.com/stairlin/lego/net/grpc"
-	"github.com/stairlin/lego/net/naming"
 	"google.golang.org/grpc"
 )
 
@@ -41,9 +40,7 @@ func start() error {
 		grpc.WithInsecure(),
 		grpc.WithTimeout(time.Second*10),
 		grpc.WithBlock(),
-		grpc.WithBalancer(grpc.RoundRobin(
-			lgrpc.WrapResolver(naming.URI(app.Ctx())),
-		)),
+		lgrpc.WithBalancer(lgrpc.RoundRobinBalancer),
 	)
 	if err != nil {
 		return errors.Wrap(err, "error connecting to server")
@@ -1,35 +1,20 @@
 package lego
 
-import "time"
+import (
+	"time"
 
-// heartbeat sends a heartbeat to stats periodically
-type hearbeat struct {
-	app  *App
-	stop chan bool
-}
-
-// Start starts sending a heartbeat
-func (h *hearbeat) Start() {
-	h.stop = make(chan bool, 1)
+	"github.com/stairlin/lego/bg"
+)
 
-	tick := time.Tick(5 * time.Second)
-	for {
-		select {
-		case <-h.stop:
-			break
-		case <-tick:
-			tags := map[string]string{
-				"service": h.app.service,
-				"node":    h.app.config.Node,
-				"version": h.app.config.Version,
-			}
-
-			h.app.Ctx().Stats().Histogram("heartbeat", 1, tags)
+// newHeartbeat returns a job which sends a heartbeat to stats periodically
+func newHeartbeat(a *App) *bg.Periodic {
+	return bg.NewPeriodic(5*time.Second, func() {
+		tags := map[string]string{
+			"service": a.service,
+			"node":    a.config.Node,
+			"version": a.config.Version,
 		}
-	}
-}
 
-// Stop stops sending a heartbeat
-func (h *hearbeat) Stop() {
-	h.stop <- true
+		a.Ctx().Stats().Histogram("heartbeat", 1, tags)
+	}, bg.WithName("heartbeat"))
 }
@@ -0,0 +1,380 @@
+package balancer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/ctx/app"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/net/naming"
+)
+
+const (
+	// DefaultMinBackoff is the default delay before watching a target again
+	// after the watcher failed for the first time
+	DefaultMinBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the default maximum delay before watching a target
+	// again
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+var (
+	// ErrNoAddress is returned when no address is available
+	ErrNoAddress = errors.New("net/balancer: no address available")
+	// ErrClosed is returned when the balancer is closed
+	ErrClosed = errors.New("net/balancer: balancer closed")
+)
+
+// Address is a resolved address
+type Address struct {
+	Addr string
+	// Weight is the relative amount of traffic the address should receive
+	Weight int
+}
+
+func (a Address) weight() int {
+	if a.Weight <= 0 {
+		return 1
+	}
+	return a.Weight
+}
+
+// Policy picks an address for each request. Implementations must be safe for
+// concurrent use.
+type Policy interface {
+	// Update replaces the set of available addresses
+	Update(addrs []Address)
+	// Pick returns the address to send a request to. done must be called once
+	// the request completes.
+	Pick(ctx context.Context) (addr string, done func(), err error)
+}
+
+// Option configures a balancer
+type Option func(*Options)
+
+// Options contains the balancer options
+type Options struct {
+	// RequireUp tells whether addresses must be marked up before being picked
+	RequireUp bool
+	// OnUpdate is called with all resolved addresses after each update
+	OnUpdate func(addrs []Address)
+	// MinBackoff and MaxBackoff bound the delay between two watcher failures
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// RequireUp makes addresses unavailable until they are marked up
+func RequireUp() Option {
+	return func(o *Options) {
+		o.RequireUp = true
+	}
+}
+
+// OnUpdate registers a function called with all resolved addresses after
+// each update
+func OnUpdate(f func(addrs []Address)) Option {
+	return func(o *Options) {
+		o.OnUpdate = f
+	}
+}
+
+// WithBackoff sets the delay before calling the watcher again once it has
+// failed. It starts at min and doubles on every consecutive failure, up to max.
+func WithBackoff(min, max time.Duration) Option {
+	return func(o *Options) {
+		o.MinBackoff = min
+		o.MaxBackoff = max
+	}
+}
+
+// Balancer keeps track of the addresses of a target, and picks one of them
+// for each request using a policy
+type Balancer struct {
+	policy Policy
+	w      naming.Watcher
+	opts   Options
+
+	mu sync.Mutex
+	// resolved contains all addresses returned by the watcher
+	resolved map[string]Address
+	// up contains the addresses which can be picked
+	up     map[string]bool
+	synced bool
+	closed bool
+	err    error
+	// stopped tells whether the watcher has been closed
+	stopped bool
+	// changed is closed (and replaced) whenever the available addresses change
+	changed chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New returns a balancer which picks addresses returned by w with policy p
+func New(w naming.Watcher, p Policy, o ...Option) *Balancer {
+	b := &Balancer{
+		policy:   p,
+		w:        w,
+		resolved: map[string]Address{},
+		up:       map[string]bool{},
+		changed:  make(chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		opts: Options{
+			MinBackoff: DefaultMinBackoff,
+			MaxBackoff: DefaultMaxBackoff,
+		},
+	}
+	for _, f := range o {
+		f(&b.opts)
+	}
+	go b.watch()
+	return b
+}
+
+// Resolve resolves uri with the naming package, and returns a balancer
+// which picks its addresses with policy p
+func Resolve(
+	ctx app.Ctx, uri string, p Policy, o ...Option,
+) (*Balancer, error) {
+	w, err := naming.Resolve(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return New(w, p, o...), nil
+}
+
+// Pick returns the address to send a request to. It waits until the target
+// has been resolved once, and then fails fast when no address is available.
+// done must be called once the request completes.
+func (b *Balancer) Pick(ctx context.Context) (addr string, done func(), err error) {
+	b.mu.Lock()
+	for !b.synced && !b.closed {
+		ch := b.changed
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-ch:
+		}
+		b.mu.Lock()
+	}
+	closed, werr := b.closed, b.err
+	b.mu.Unlock()
+	if closed {
+		return "", nil, ErrClosed
+	}
+
+	addr, done, err = b.policy.Pick(ctx)
+	if err == ErrNoAddress && werr != nil {
+		return "", nil, errors.Wrap(werr, "net/balancer: watcher failed")
+	}
+	return addr, done, err
+}
+
+// Wait blocks until at least one address is available
+func (b *Balancer) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	for {
+		if b.closed {
+			b.mu.Unlock()
+			return ErrClosed
+		}
+		if b.available() > 0 {
+			b.mu.Unlock()
+			return nil
+		}
+		ch := b.changed
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+		b.mu.Lock()
+	}
+}
+
+// Addrs returns all resolved addresses, whether they are up or not
+func (b *Balancer) Addrs() []Address {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.addrs()
+}
+
+// Up makes addr available
+func (b *Balancer) Up(addr string) {
+	b.setState(addr, true)
+}
+
+// Down makes addr unavailable until it is marked up again
+func (b *Balancer) Down(addr string) {
+	b.setState(addr, false)
+}
+
+// Err returns the error which stopped the watcher, or nil while the target
+// is still being watched. Such a balancer no longer receives updates, so it
+// should be closed and the target resolved again.
+func (b *Balancer) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.stopped {
+		return nil
+	}
+	return b.err
+}
+
+// Close stops watching the target. Pending and future picks fail.
+func (b *Balancer) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.notify()
+	close(b.stop)
+	b.mu.Unlock()
+
+	err := b.w.Close()
+	<-b.done
+	return err
+}
+
+// watch applies watcher updates until the watcher is closed. Other watcher
+// errors, such as an unreachable registry, are retried with a backoff.
+func (b *Balancer) watch() {
+	defer close(b.done)
+
+	for failures := 0; ; {
+		updates, err := b.w.Next()
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return
+		}
+		if err != nil {
+			stopped := err == naming.ErrWatcherClosed
+			b.err = err
+			b.synced = true
+			b.stopped = stopped
+			b.notify()
+			b.mu.Unlock()
+			if stopped {
+				return
+			}
+
+			select {
+			case <-b.stop:
+				return
+			case <-time.After(b.backoff(failures)):
+			}
+			failures++
+			continue
+		}
+		failures = 0
+		b.err = nil
+		for _, u := range updates {
+			switch u.Op {
+			case naming.Add:
+				b.resolved[u.Addr] = Address{Addr: u.Addr, Weight: weight(u)}
+				if _, ok := b.up[u.Addr]; !ok {
+					b.up[u.Addr] = !b.opts.RequireUp
+				}
+			case naming.Delete:
+				delete(b.resolved, u.Addr)
+				delete(b.up, u.Addr)
+			}
+		}
+		b.synced = true
+		b.update()
+		addrs := b.addrs()
+		b.mu.Unlock()
+
+		if b.opts.OnUpdate != nil {
+			b.opts.OnUpdate(addrs)
+		}
+	}
+}
+
+// backoff returns the delay before calling the watcher again
+func (b *Balancer) backoff(failures int) time.Duration {
+	d := b.opts.MinBackoff
+	for i := 0; i < failures && d < b.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > b.opts.MaxBackoff {
+		d = b.opts.MaxBackoff
+	}
+	return d
+}
+
+func (b *Balancer) setState(addr string, up bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.resolved[addr]; !ok || b.up[addr] == up {
+		return
+	}
+	b.up[addr] = up
+	b.update()
+}
+
+// update feeds the policy with the available addresses
+func (b *Balancer) update() {
+	var addrs []Address
+	for _, a := range b.addrs() {
+		if b.up[a.Addr] {
+			addrs = append(addrs, a)
+		}
+	}
+	b.policy.Update(addrs)
+	b.notify()
+}
+
+func (b *Balancer) available() int {
+	n := 0
+	for addr := range b.resolved {
+		if b.up[addr] {
+			n++
+		}
+	}
+	return n
+}
+
+func (b *Balancer) addrs() []Address {
+	addrs := make([]Address, 0, len(b.resolved))
+	for _, a := range b.resolved {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	return addrs
+}
+
+// notify wakes up all pending picks
+func (b *Balancer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// weight returns the weight carried by the update metadata (default 1)
+func weight(u *naming.Update) int {
+	w := 1
+	switch m := u.Metadata.(type) {
+	case int:
+		w = m
+	case *disco.Instance:
+		w = m.Weight
+	}
+	if w <= 0 {
+		return 1
+	}
+	return w
+}
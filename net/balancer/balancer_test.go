@@ -0,0 +1,214 @@
+package balancer_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/net/balancer"
+	"github.com/stairlin/lego/net/naming"
+)
+
+func TestBalancerPick(t *testing.T) {
+	w := newWatcher()
+	b := balancer.New(w, balancer.RoundRobin())
+	defer b.Close()
+
+	w.add("10.0.0.1:80", "10.0.0.2:80")
+	got := map[string]int{}
+	for i := 0; i < 4; i++ {
+		addr, done, err := b.Pick(context.Background())
+		if err != nil {
+			t.Fatal("expect to pick an address", err)
+		}
+		done()
+		got[addr]++
+	}
+	if got["10.0.0.1:80"] != 2 || got["10.0.0.2:80"] != 2 {
+		t.Errorf("expect picks to be spread evenly, but got %v", got)
+	}
+
+	w.delete("10.0.0.1:80", "10.0.0.2:80")
+	waitFor(t, func() bool { return len(b.Addrs()) == 0 })
+	if _, _, err := b.Pick(context.Background()); err != balancer.ErrNoAddress {
+		t.Errorf("expect ErrNoAddress, but got %v", err)
+	}
+}
+
+func TestBalancerWaitsForResolution(t *testing.T) {
+	w := newWatcher()
+	b := balancer.New(w, balancer.RoundRobin())
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := b.Pick(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expect pick to wait for the first resolution, but got %v", err)
+	}
+
+	go w.add("10.0.0.1:80")
+	addr, _, err := b.Pick(context.Background())
+	if err != nil || addr != "10.0.0.1:80" {
+		t.Errorf("expect to pick 10.0.0.1:80, but got %s (%v)", addr, err)
+	}
+}
+
+func TestBalancerRequireUp(t *testing.T) {
+	w := newWatcher()
+	var mu sync.Mutex
+	var updates [][]balancer.Address
+	b := balancer.New(w, balancer.RoundRobin(),
+		balancer.RequireUp(),
+		balancer.OnUpdate(func(addrs []balancer.Address) {
+			mu.Lock()
+			updates = append(updates, addrs)
+			mu.Unlock()
+		}),
+	)
+
+	w.send(&naming.Update{
+		Op:       naming.Add,
+		Addr:     "10.0.0.1:80",
+		Metadata: &disco.Instance{Weight: 3},
+	})
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(updates) == 1
+	})
+	if updates[0][0].Weight != 3 {
+		t.Errorf("expect to be notified with weighted addresses, but got %v", updates)
+	}
+	if _, _, err := b.Pick(context.Background()); err != balancer.ErrNoAddress {
+		t.Errorf("expect addresses to be down, but got %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- b.Wait(context.Background())
+	}()
+	b.Up("10.0.0.1:80")
+	if err := <-errc; err != nil {
+		t.Errorf("expect wait to return once an address is up, but got %v", err)
+	}
+	if addr, _, err := b.Pick(context.Background()); err != nil || addr != "10.0.0.1:80" {
+		t.Errorf("expect to pick 10.0.0.1:80, but got %s (%v)", addr, err)
+	}
+
+	b.Down("10.0.0.1:80")
+	if _, _, err := b.Pick(context.Background()); err != balancer.ErrNoAddress {
+		t.Errorf("expect address to be down, but got %v", err)
+	}
+
+	b.Close()
+	if _, _, err := b.Pick(context.Background()); err != balancer.ErrClosed {
+		t.Errorf("expect balancer to be closed, but got %v", err)
+	}
+	if err := b.Wait(context.Background()); err != balancer.ErrClosed {
+		t.Errorf("expect balancer to be closed, but got %v", err)
+	}
+}
+
+func TestBalancerWatcherErrors(t *testing.T) {
+	w := newWatcher()
+	fw := &failingWatcher{watcher: w, failures: 1}
+	b := balancer.New(fw, balancer.RoundRobin(),
+		balancer.WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	defer b.Close()
+
+	// Transient errors are retried
+	if _, _, err := b.Pick(context.Background()); err == nil {
+		t.Error("expect pick to fail while the watcher is failing")
+	}
+	if err := b.Err(); err != nil {
+		t.Errorf("expect balancer to keep watching, but got %v", err)
+	}
+	w.add("10.0.0.1:80")
+	waitFor(t, func() bool { return len(b.Addrs()) == 1 })
+	if addr, _, err := b.Pick(context.Background()); err != nil || addr != "10.0.0.1:80" {
+		t.Errorf("expect to pick 10.0.0.1:80, but got %s (%v)", addr, err)
+	}
+
+	// A closed watcher stops the balancer
+	w.Close()
+	waitFor(t, func() bool { return b.Err() == naming.ErrWatcherClosed })
+}
+
+// failingWatcher is a watcher which fails a number of times before
+// delegating to another watcher
+type failingWatcher struct {
+	*watcher
+	failures int
+}
+
+func (w *failingWatcher) Next() ([]*naming.Update, error) {
+	if w.failures > 0 {
+		w.failures--
+		return nil, errors.New("registry unreachable")
+	}
+	return w.watcher.Next()
+}
+
+// watcher is a naming.Watcher fed by the test
+type watcher struct {
+	c    chan []*naming.Update
+	once sync.Once
+	done chan struct{}
+}
+
+func newWatcher() *watcher {
+	return &watcher{
+		c:    make(chan []*naming.Update),
+		done: make(chan struct{}),
+	}
+}
+
+func (w *watcher) Next() ([]*naming.Update, error) {
+	select {
+	case <-w.done:
+		return nil, naming.ErrWatcherClosed
+	case u := <-w.c:
+		return u, nil
+	}
+}
+
+func (w *watcher) Close() error {
+	w.once.Do(func() {
+		close(w.done)
+	})
+	return nil
+}
+
+func (w *watcher) send(u ...*naming.Update) {
+	w.c <- u
+}
+
+func (w *watcher) add(addrs ...string) {
+	var l []*naming.Update
+	for _, a := range addrs {
+		l = append(l, &naming.Update{Op: naming.Add, Addr: a})
+	}
+	w.send(l...)
+}
+
+func (w *watcher) delete(addrs ...string) {
+	var l []*naming.Update
+	for _, a := range addrs {
+		l = append(l, &naming.Update{Op: naming.Delete, Addr: a})
+	}
+	w.send(l...)
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,14 @@
+// Package balancer spreads client requests across the addresses of a target
+// resolved by the naming package.
+//
+// A Balancer consumes a naming.Watcher, and delegates the choice of an
+// address to a Policy:
+//  - RoundRobin
+//  - Weighted (smooth weighted round-robin)
+//  - LeastOutstanding
+//  - P2C (power of two choices)
+//  - ConsistentHash
+//
+// Balancers can be used by the net/http client, and policies are registered
+// with gRPC by the net/grpc package.
+package balancer
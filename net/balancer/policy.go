@@ -0,0 +1,300 @@
+package balancer
+
+import (
+	"context"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultReplicas is the default number of points per address on the
+// consistent hashing ring
+const DefaultReplicas = 100
+
+func noop() {}
+
+// RoundRobin returns a policy which picks addresses in turn
+func RoundRobin() Policy {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next  uint64
+	mu    sync.RWMutex
+	addrs []string
+}
+
+func (p *roundRobin) Update(addrs []Address) {
+	l := make([]string, len(addrs))
+	for i, a := range addrs {
+		l[i] = a.Addr
+	}
+
+	p.mu.Lock()
+	p.addrs = l
+	p.mu.Unlock()
+}
+
+func (p *roundRobin) Pick(ctx context.Context) (string, func(), error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.addrs) == 0 {
+		return "", nil, ErrNoAddress
+	}
+	n := atomic.AddUint64(&p.next, 1)
+	return p.addrs[(n-1)%uint64(len(p.addrs))], noop, nil
+}
+
+// Weighted returns a policy which picks addresses in proportion to their
+// weight. Picks are interleaved (smooth weighted round-robin), so that an
+// address with a high weight does not receive bursts of requests.
+func Weighted() Policy {
+	return &weighted{}
+}
+
+type weighted struct {
+	mu    sync.Mutex
+	peers []*peer
+	total int
+}
+
+type peer struct {
+	addr    string
+	weight  int
+	current int
+}
+
+func (p *weighted) Update(addrs []Address) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.peers = make([]*peer, len(addrs))
+	p.total = 0
+	for i, a := range addrs {
+		p.peers[i] = &peer{addr: a.Addr, weight: a.weight()}
+		p.total += a.weight()
+	}
+}
+
+func (p *weighted) Pick(ctx context.Context) (string, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.peers) == 0 {
+		return "", nil, ErrNoAddress
+	}
+	var best *peer
+	for _, peer := range p.peers {
+		peer.current += peer.weight
+		if best == nil || peer.current > best.current {
+			best = peer
+		}
+	}
+	best.current -= p.total
+	return best.addr, noop, nil
+}
+
+// LeastOutstanding returns a policy which picks the address with the fewest
+// requests in flight
+func LeastOutstanding() Policy {
+	return &leastOutstanding{}
+}
+
+type leastOutstanding struct {
+	next     uint64
+	inflight inflight
+}
+
+func (p *leastOutstanding) Update(addrs []Address) {
+	p.inflight.update(addrs)
+}
+
+func (p *leastOutstanding) Pick(ctx context.Context) (string, func(), error) {
+	p.inflight.mu.RLock()
+	defer p.inflight.mu.RUnlock()
+
+	l := p.inflight.addrs
+	if len(l) == 0 {
+		return "", nil, ErrNoAddress
+	}
+
+	// Start from a rotating offset to spread ties
+	start := int(atomic.AddUint64(&p.next, 1) % uint64(len(l)))
+	best := l[start]
+	for i := 1; i < len(l) && best.load() > 0; i++ {
+		c := l[(start+i)%len(l)]
+		if c.load() < best.load() {
+			best = c
+		}
+	}
+	return best.addr, best.acquire(), nil
+}
+
+// P2C returns a policy which picks two addresses at random, and then picks
+// the one with the fewest requests in flight relative to its weight
+func P2C() Policy {
+	return &p2c{}
+}
+
+type p2c struct {
+	inflight inflight
+}
+
+func (p *p2c) Update(addrs []Address) {
+	p.inflight.update(addrs)
+}
+
+func (p *p2c) Pick(ctx context.Context) (string, func(), error) {
+	p.inflight.mu.RLock()
+	defer p.inflight.mu.RUnlock()
+
+	l := p.inflight.addrs
+	switch len(l) {
+	case 0:
+		return "", nil, ErrNoAddress
+	case 1:
+		return l[0].addr, l[0].acquire(), nil
+	}
+
+	i := rand.Intn(len(l))
+	j := rand.Intn(len(l) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := l[i], l[j]
+	// Compare load/weight without divisions
+	if b.load()*int64(a.weight) < a.load()*int64(b.weight) {
+		a = b
+	}
+	return a.addr, a.acquire(), nil
+}
+
+// inflight tracks the number of requests in flight per address
+type inflight struct {
+	mu    sync.RWMutex
+	addrs []*counter
+}
+
+type counter struct {
+	n      int64
+	addr   string
+	weight int
+}
+
+func (c *counter) load() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// acquire increments the counter, and returns a function to decrement it
+func (c *counter) acquire() func() {
+	atomic.AddInt64(&c.n, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&c.n, -1)
+		})
+	}
+}
+
+// update replaces the addresses, and keeps the counters of the addresses
+// which are still available
+func (f *inflight) update(addrs []Address) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prev := map[string]*counter{}
+	for _, c := range f.addrs {
+		prev[c.addr] = c
+	}
+	f.addrs = make([]*counter, len(addrs))
+	for i, a := range addrs {
+		c, ok := prev[a.Addr]
+		if !ok {
+			c = &counter{addr: a.Addr}
+		}
+		c.weight = a.weight()
+		f.addrs[i] = c
+	}
+}
+
+type hashKey struct{}
+
+// WithHashKey returns a copy of ctx which carries the key used by the
+// consistent hashing policy
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// HashKey returns the consistent hashing key carried by ctx
+func HashKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKey{}).(string)
+	return key, ok
+}
+
+// ConsistentHash returns a policy which always picks the same address for a
+// given key (see WithHashKey), as long as that address is available. Each
+// address is placed replicas*weight times on the ring. Requests without a
+// key are sent to a random address.
+func ConsistentHash(replicas int) Policy {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &consistentHash{replicas: replicas}
+}
+
+type consistentHash struct {
+	replicas int
+
+	mu     sync.RWMutex
+	ring   []uint32
+	points map[uint32]string
+	addrs  []string
+}
+
+func (p *consistentHash) Update(addrs []Address) {
+	ring := []uint32{}
+	points := map[uint32]string{}
+	l := make([]string, len(addrs))
+	for i, a := range addrs {
+		l[i] = a.Addr
+		for r := 0; r < p.replicas*a.weight(); r++ {
+			h := crc32.ChecksumIEEE([]byte(a.Addr + "#" + strconv.Itoa(r)))
+			if _, ok := points[h]; ok {
+				continue
+			}
+			points[h] = a.Addr
+			ring = append(ring, h)
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i] < ring[j] })
+
+	p.mu.Lock()
+	p.ring = ring
+	p.points = points
+	p.addrs = l
+	p.mu.Unlock()
+}
+
+func (p *consistentHash) Pick(ctx context.Context) (string, func(), error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.addrs) == 0 {
+		return "", nil, ErrNoAddress
+	}
+	key, ok := HashKey(ctx)
+	if !ok {
+		return p.addrs[rand.Intn(len(p.addrs))], noop, nil
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i] >= h })
+	if i == len(p.ring) {
+		i = 0
+	}
+	return p.points[p.ring[i]], noop, nil
+}
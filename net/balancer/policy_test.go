@@ -0,0 +1,176 @@
+package balancer_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stairlin/lego/net/balancer"
+)
+
+var addrs = []balancer.Address{
+	{Addr: "a", Weight: 1},
+	{Addr: "b", Weight: 2},
+	{Addr: "c", Weight: 3},
+}
+
+func TestPoliciesWithoutAddress(t *testing.T) {
+	policies := map[string]balancer.Policy{
+		"round_robin":       balancer.RoundRobin(),
+		"weighted":          balancer.Weighted(),
+		"least_outstanding": balancer.LeastOutstanding(),
+		"p2c":               balancer.P2C(),
+		"consistent_hash":   balancer.ConsistentHash(0),
+	}
+	for name, p := range policies {
+		if _, _, err := p.Pick(context.Background()); err != balancer.ErrNoAddress {
+			t.Errorf("%s: expect ErrNoAddress, but got %v", name, err)
+		}
+		p.Update(addrs)
+		p.Update(nil)
+		if _, _, err := p.Pick(context.Background()); err != balancer.ErrNoAddress {
+			t.Errorf("%s: expect ErrNoAddress after update, but got %v", name, err)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	p := balancer.RoundRobin()
+	p.Update(addrs)
+
+	expect := "abcabc"
+	got := ""
+	for i := 0; i < len(expect); i++ {
+		got += pick(t, p, context.Background())
+	}
+	if expect != got {
+		t.Errorf("expect picks %s, but got %s", expect, got)
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	p := balancer.Weighted()
+	p.Update(addrs)
+
+	// Smooth weighted round-robin interleaves picks
+	expect := "cbacbc"
+	got := ""
+	for i := 0; i < len(expect); i++ {
+		got += pick(t, p, context.Background())
+	}
+	if expect != got {
+		t.Errorf("expect picks %s, but got %s", expect, got)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	p := balancer.LeastOutstanding()
+	p.Update(addrs)
+
+	// Hold one request on each address but c
+	var dones []func()
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		addr, done, err := p.Pick(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr == "c" || seen[addr] {
+			done()
+			continue
+		}
+		seen[addr] = true
+		dones = append(dones, done)
+	}
+	for i := 0; i < 3; i++ {
+		addr, done, err := p.Pick(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != "c" {
+			t.Errorf("expect idle address c to be picked, but got %s", addr)
+		}
+		done()
+		done() // done is idempotent
+	}
+
+	// Counters survive updates
+	p.Update(addrs[:2])
+	for _, done := range dones {
+		done()
+	}
+	if addr := pick(t, p, context.Background()); addr != "a" && addr != "b" {
+		t.Errorf("expect a or b to be picked, but got %s", addr)
+	}
+}
+
+func TestP2C(t *testing.T) {
+	p := balancer.P2C()
+	p.Update(addrs[:2])
+
+	// a is busy, so b always wins
+	_, done, err := p.Pick(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var busy string
+	for i := 0; i < 10; i++ {
+		addr, d, err := p.Pick(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if busy == "" {
+			busy = addr
+		} else if busy != addr {
+			t.Errorf("expect the least loaded address %s to be picked, but got %s", busy, addr)
+		}
+		d()
+	}
+	done()
+
+	p.Update(addrs[:1])
+	if addr := pick(t, p, context.Background()); addr != "a" {
+		t.Errorf("expect a to be picked, but got %s", addr)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	p := balancer.ConsistentHash(50)
+	p.Update(addrs)
+
+	picks := map[string]string{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		ctx := balancer.WithHashKey(context.Background(), key)
+		picks[key] = pick(t, p, ctx)
+		if again := pick(t, p, ctx); again != picks[key] {
+			t.Fatalf("expect %s to stick to %s, but got %s", key, picks[key], again)
+		}
+	}
+
+	// Only keys of the removed address move
+	p.Update(addrs[:2])
+	for key, prev := range picks {
+		addr := pick(t, p, balancer.WithHashKey(context.Background(), key))
+		if prev != "c" && addr != prev {
+			t.Errorf("expect %s to stay on %s, but moved to %s", key, prev, addr)
+		}
+		if addr == "c" {
+			t.Errorf("expect %s to move away from c", key)
+		}
+	}
+
+	// Requests without key are spread randomly
+	if addr := pick(t, p, context.Background()); addr != "a" && addr != "b" {
+		t.Errorf("expect a or b to be picked, but got %s", addr)
+	}
+}
+
+func pick(t *testing.T, p balancer.Policy, ctx context.Context) string {
+	addr, done, err := p.Pick(ctx)
+	if err != nil {
+		t.Fatal("expect to pick an address", err)
+	}
+	done()
+	return addr
+}
@@ -0,0 +1,17 @@
+// Package cert keeps TLS certificates up to date, so that short-lived
+// certificates can be rotated without restarting servers or clients.
+//
+// A Manager loads a certificate, its key and the pool of certificate
+// authorities from a Source, and reloads them periodically. The current
+// certificate is served through the callbacks of tls.Config, which are called
+// on every handshake:
+//
+//	m := cert.NewManager(cert.Files("cert.pem", "key.pem", "ca.pem"), log, stats)
+//	defer m.Close()
+//
+//	server := &http.Server{TLSConfig: m.ServerConfig(false)}
+//
+// Failures to load a certificate are logged, and the previous certificate
+// is kept. The time left before the certificate expires is sent as the
+// "cert.expiry" gauge (in seconds).
+package cert
@@ -0,0 +1,232 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/stairlin/lego/log"
+	"github.com/stairlin/lego/stats"
+)
+
+// DefaultInterval is the default time between two reloads
+const DefaultInterval = time.Minute
+
+// ErrNoCertificate is the error returned during handshakes when no
+// certificate has been loaded yet
+var ErrNoCertificate = errors.New("cert: no certificate loaded")
+
+// Option configures a manager
+type Option func(*Manager)
+
+// WithInterval sets the time between two reloads. A zero interval disables
+// periodic reloads.
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		m.interval = d
+	}
+}
+
+// Manager serves the latest certificate loaded from a source
+type Manager struct {
+	mu sync.RWMutex
+
+	src      Source
+	interval time.Duration
+	log      log.Logger
+	stats    stats.Stats
+
+	cert  *tls.Certificate
+	leaf  *x509.Certificate
+	pool  *x509.CertPool
+	stopc chan struct{}
+	once  sync.Once
+}
+
+// NewManager creates a manager which loads a certificate from src, and then
+// reloads it periodically until Close is called
+func NewManager(
+	src Source, log log.Logger, stats stats.Stats, o ...Option,
+) *Manager {
+	m := &Manager{
+		src:      src,
+		interval: DefaultInterval,
+		log:      log,
+		stats:    stats,
+		stopc:    make(chan struct{}),
+	}
+	for _, opt := range o {
+		opt(m)
+	}
+
+	m.Reload()
+	if m.interval > 0 {
+		go m.run()
+	}
+	return m
+}
+
+// Reload loads the certificate from the source. The previous certificate is
+// kept when it fails.
+func (m *Manager) Reload() error {
+	cert, pool, err := m.src.Load()
+	if err == nil && cert.Leaf == nil && len(cert.Certificate) > 0 {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if err != nil {
+		m.log.Warning("cert.load.err", "Cannot load certificate", log.Error(err))
+		return err
+	}
+
+	m.mu.Lock()
+	changed := m.leaf == nil || cert.Leaf == nil ||
+		!bytes.Equal(m.leaf.Raw, cert.Leaf.Raw)
+	m.cert, m.leaf, m.pool = cert, cert.Leaf, pool
+	m.mu.Unlock()
+
+	if cert.Leaf == nil {
+		return nil
+	}
+	if changed {
+		m.log.Trace("cert.load", "Certificate loaded",
+			log.String("subject", cert.Leaf.Subject.CommonName),
+			log.Time("not_after", cert.Leaf.NotAfter),
+		)
+	}
+	m.gaugeExpiry(cert.Leaf)
+	return nil
+}
+
+// Close stops reloading the certificate
+func (m *Manager) Close() error {
+	m.once.Do(func() { close(m.stopc) })
+	return nil
+}
+
+// Certificate returns the current certificate
+func (m *Manager) Certificate() (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return m.cert, nil
+}
+
+// Pool returns the current pool of certificate authorities. It returns nil
+// when the source has none.
+func (m *Manager) Pool() *x509.CertPool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pool
+}
+
+// GetCertificate returns the current certificate. It can be used as the
+// tls.Config GetCertificate callback.
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.Certificate()
+}
+
+// GetClientCertificate returns the current certificate. It can be used as the
+// tls.Config GetClientCertificate callback.
+func (m *Manager) GetClientCertificate(
+	*tls.CertificateRequestInfo,
+) (*tls.Certificate, error) {
+	return m.Certificate()
+}
+
+// ServerConfig returns a server TLS config which uses the current certificate.
+// When mutual is true, clients must present a certificate signed by one of the
+// current certificate authorities.
+//
+// The config can be cloned and extended, e.g. with NextProtos.
+func (m *Manager) ServerConfig(mutual bool) *tls.Config {
+	c := &tls.Config{GetCertificate: m.GetCertificate}
+	if mutual {
+		// Client certificates are verified by VerifyPeerCertificate, because
+		// ClientCAs cannot be changed once the config is in use
+		c.ClientAuth = tls.RequireAnyClientCert
+		c.VerifyPeerCertificate = func(raw [][]byte, _ [][]*x509.Certificate) error {
+			return m.verify(raw, x509.VerifyOptions{
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+		}
+	}
+	return c
+}
+
+// ClientConfig returns a client TLS config which presents the current
+// certificate, and verifies that the server certificate is valid for
+// serverName and signed by one of the current certificate authorities.
+// serverName must not be empty.
+func (m *Manager) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName:           serverName,
+		GetClientCertificate: m.GetClientCertificate,
+		// The server certificate is verified by VerifyPeerCertificate, because
+		// RootCAs cannot be changed once the config is in use
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if serverName == "" {
+				return errors.New("cert: missing server name")
+			}
+			return m.verify(raw, x509.VerifyOptions{DNSName: serverName})
+		},
+	}
+}
+
+// verify verifies the certificate chain sent by a peer against the current
+// certificate authorities
+func (m *Manager) verify(raw [][]byte, opts x509.VerifyOptions) error {
+	if len(raw) == 0 {
+		return errors.New("cert: no peer certificate")
+	}
+	certs := make([]*x509.Certificate, len(raw))
+	for i := range raw {
+		c, err := x509.ParseCertificate(raw[i])
+		if err != nil {
+			return err
+		}
+		certs[i] = c
+	}
+
+	opts.Roots = m.Pool()
+	opts.Intermediates = x509.NewCertPool()
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+func (m *Manager) run() {
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			m.Reload()
+		case <-m.stopc:
+			return
+		}
+	}
+}
+
+// gaugeExpiry sends the number of seconds left before the certificate expires
+func (m *Manager) gaugeExpiry(leaf *x509.Certificate) {
+	left := time.Until(leaf.NotAfter)
+	m.stats.Gauge("cert.expiry", int64(left/time.Second), map[string]string{
+		"subject": leaf.Subject.CommonName,
+	})
+	if left <= 0 {
+		m.log.Warning("cert.expired", "Certificate has expired",
+			log.String("subject", leaf.Subject.CommonName),
+			log.Time("not_after", leaf.NotAfter),
+		)
+	}
+}
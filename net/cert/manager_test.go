@@ -0,0 +1,210 @@
+package cert_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/net/cert"
+	lt "github.com/stairlin/lego/testing"
+)
+
+// TestReload tests whether a rotated certificate is picked up by the manager
+func TestReload(t *testing.T) {
+	tt := lt.New(t)
+	dir, err := ioutil.TempDir("", "lego-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	writeCert(t, certFile, keyFile, "first")
+	m := cert.NewManager(cert.Files(certFile, keyFile, ""), tt.Logger(), tt.Stats(),
+		cert.WithInterval(10*time.Millisecond),
+	)
+	defer m.Close()
+	if cn := commonName(t, m); cn != "first" {
+		t.Errorf("expect certificate first, but got %s", cn)
+	}
+
+	writeCert(t, certFile, keyFile, "second")
+	time.Sleep(50 * time.Millisecond)
+	if cn := commonName(t, m); cn != "second" {
+		t.Errorf("expect certificate second, but got %s", cn)
+	}
+}
+
+// TestLoadError tests whether a manager without certificate fails handshakes
+// rather than panicking
+func TestLoadError(t *testing.T) {
+	tt := lt.New(t)
+	m := cert.NewManager(cert.Files("missing.pem", "missing.key", ""),
+		tt.Logger(), tt.Stats(), cert.WithInterval(0),
+	)
+	if _, err := m.GetCertificate(nil); err != cert.ErrNoCertificate {
+		t.Errorf("expect ErrNoCertificate, but got %v", err)
+	}
+}
+
+// TestMutualTLS tests whether a server and a client can authenticate each
+// other with certificates served by managers
+func TestMutualTLS(t *testing.T) {
+	tt := lt.New(t)
+	ca, caKey := newCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	source := func(cn string) cert.Source {
+		return cert.SourceFunc(func() (*tls.Certificate, *x509.CertPool, error) {
+			c := newCert(t, cn, ca, caKey)
+			return &c, pool, nil
+		})
+	}
+
+	server := cert.NewManager(source("127.0.0.1"), tt.Logger(), tt.Stats())
+	defer server.Close()
+	client := cert.NewManager(source("client"), tt.Logger(), tt.Stats())
+	defer client.Close()
+
+	// Extensions of the config must be preserved
+	serverConfig := server.ServerConfig(true).Clone()
+	serverConfig.NextProtos = []string{"h2"}
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	errc := make(chan error, 3)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			errc <- conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	clientConfig := client.ClientConfig("127.0.0.1")
+	clientConfig.NextProtos = []string{"h2"}
+	conn, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto := conn.ConnectionState().NegotiatedProtocol
+	conn.Close()
+	if err := <-errc; err != nil {
+		t.Error("expect server handshake to succeed", err)
+	}
+	if proto != "h2" {
+		t.Errorf("expect protocol h2 to be negotiated, but got %q", proto)
+	}
+
+	// Clients without certificate are rejected
+	anonymous := &tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+	if conn, err := tls.Dial("tcp", lis.Addr().String(), anonymous); err == nil {
+		// TLS 1.3 clients learn about the rejection on their first read
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+		if err == nil {
+			t.Error("expect a client without certificate to be rejected")
+		}
+	}
+	if err := <-errc; err == nil {
+		t.Error("expect server handshake to fail without client certificate")
+	}
+
+	// The server name is verified
+	_, err = tls.Dial("tcp", lis.Addr().String(), client.ClientConfig("example.com"))
+	if err == nil {
+		t.Error("expect handshake to fail with a wrong server name")
+	}
+}
+
+func commonName(t *testing.T, m *cert.Manager) string {
+	c, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Leaf.Subject.CommonName
+}
+
+func writeCert(t *testing.T, certFile, keyFile, cn string) {
+	ca, caKey := newCA(t)
+	c := newCert(t, cn, ca, caKey)
+	key, err := x509.MarshalECPrivateKey(c.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, key
+}
+
+func newCert(
+	t *testing.T, cn string, ca *x509.Certificate, caKey *ecdsa.PrivateKey,
+) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth,
+		},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,58 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Source loads a certificate and the pool of certificate authorities used to
+// verify peers. The pool may be nil.
+type Source interface {
+	Load() (*tls.Certificate, *x509.CertPool, error)
+}
+
+// SourceFunc is an adapter to use ordinary functions as sources
+type SourceFunc func() (*tls.Certificate, *x509.CertPool, error)
+
+// Load calls f()
+func (f SourceFunc) Load() (*tls.Certificate, *x509.CertPool, error) {
+	return f()
+}
+
+// Files returns a source which reads PEM encoded files. If the certificate is
+// signed by a certificate authority, certFile should be the concatenation of
+// the certificate, any intermediates, and the CA's certificate.
+//
+// caFile is optional. When empty, peers are verified with the system pool.
+func Files(certFile, keyFile, caFile string) Source {
+	return &fileSource{certFile: certFile, keyFile: keyFile, caFile: caFile}
+}
+
+type fileSource struct {
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+func (s *fileSource) Load() (*tls.Certificate, *x509.CertPool, error) {
+	certificate, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not load key pair")
+	}
+	if s.caFile == "" {
+		return &certificate, nil, nil
+	}
+
+	ca, err := ioutil.ReadFile(s.caFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not read ca certificate")
+	}
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(ca); !ok {
+		return nil, nil, errors.New("could not append ca certificate")
+	}
+	return &certificate, pool, nil
+}
@@ -9,4 +9,6 @@
 // It also manages the lifecycle of the handlers. All handlers should be
 // registered to this package in order to be gracefuly stopped (drained)
 // when the application shuts down.
+//
+// A Mux serves a net/grpc and a net/http server on the same address.
 package net
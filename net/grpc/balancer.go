@@ -0,0 +1,90 @@
+package grpc
+
+import (
+	"sort"
+
+	"github.com/stairlin/lego/net/balancer"
+	"google.golang.org/grpc"
+	gbalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// Names of the lego load balancing policies registered with gRPC
+const (
+	RoundRobinBalancer       = "lego_round_robin"
+	WeightedBalancer         = "lego_weighted"
+	LeastOutstandingBalancer = "lego_least_outstanding"
+	P2CBalancer              = "lego_p2c"
+	ConsistentHashBalancer   = "lego_consistent_hash"
+)
+
+func init() {
+	policies := map[string]func() balancer.Policy{
+		RoundRobinBalancer:       balancer.RoundRobin,
+		WeightedBalancer:         balancer.Weighted,
+		LeastOutstandingBalancer: balancer.LeastOutstanding,
+		P2CBalancer:              balancer.P2C,
+		ConsistentHashBalancer: func() balancer.Policy {
+			return balancer.ConsistentHash(balancer.DefaultReplicas)
+		},
+	}
+	for name, p := range policies {
+		gbalancer.Register(base.NewBalancerBuilder(
+			name, &pickerBuilder{policy: p}, base.Config{HealthCheck: true},
+		))
+	}
+}
+
+// WithBalancer returns a dial option which spreads RPCs across the ready
+// connections with the given load balancing policy (e.g. RoundRobinBalancer).
+// Instance weights are read from the address attributes set by the lego
+// resolvers.
+func WithBalancer(name string) grpc.DialOption {
+	return grpc.WithDefaultServiceConfig(lbConfig(name))
+}
+
+// pickerBuilder builds pickers backed by a lego balancing policy
+type pickerBuilder struct {
+	policy func() balancer.Policy
+}
+
+func (b *pickerBuilder) Build(info base.PickerBuildInfo) gbalancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(gbalancer.ErrNoSubConnAvailable)
+	}
+
+	p := &picker{
+		policy: b.policy(),
+		conns:  map[string]gbalancer.SubConn{},
+	}
+	var addrs []balancer.Address
+	for sc, i := range info.ReadySCs {
+		w, _ := i.Address.Attributes.Value(WeightKey{}).(int)
+		addrs = append(addrs, balancer.Address{Addr: i.Address.Addr, Weight: w})
+		p.conns[i.Address.Addr] = sc
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	p.policy.Update(addrs)
+	return p
+}
+
+// picker implements gRPC balancer.Picker
+type picker struct {
+	policy balancer.Policy
+	conns  map[string]gbalancer.SubConn
+}
+
+func (p *picker) Pick(info gbalancer.PickInfo) (gbalancer.PickResult, error) {
+	addr, done, err := p.policy.Pick(info.Ctx)
+	if err != nil {
+		return gbalancer.PickResult{}, gbalancer.ErrNoSubConnAvailable
+	}
+	return gbalancer.PickResult{
+		SubConn: p.conns[addr],
+		Done: func(gbalancer.DoneInfo) {
+			done()
+		},
+	}, nil
+}
@@ -0,0 +1,119 @@
+package grpc_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/disco"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientWithDiscoBalancer(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	// Start two servers which reply with their address, and register them
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		s := &addrServer{}
+		h := lgrpc.NewServer()
+		h.RegisterService(&_Test_serviceDesc, s)
+		s.addr = startServer(appCtx, h)
+		addrs = append(addrs, s.addr)
+		defer h.Drain()
+
+		host, port := splitAddr(t, s.addr)
+		_, err := appCtx.Disco().Register(appCtx, &disco.Registration{
+			Name:   "test.grpc",
+			Addr:   host,
+			Port:   port,
+			Meta:   map[string]string{"az": strconv.Itoa(i)},
+			Weight: i + 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := lgrpc.NewClient(appCtx, "disco://test.grpc",
+		grpc.WithInsecure(),
+		lgrpc.WithBalancer(lgrpc.WeightedBalancer),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	client := NewTestClient(c.GRPC)
+
+	got := map[string]int{}
+	for i := 0; i < 30; i++ {
+		ctx, cancel := context.WithTimeout(journey.New(appCtx), 5*time.Second)
+		res, err := client.Hello(ctx, &Request{Msg: "Ping"}, grpc.WaitForReady(true))
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[res.Msg]++
+	}
+
+	// Requests start flowing as soon as one connection is ready, so only
+	// check that both servers receive requests
+	for _, addr := range addrs {
+		if got[addr] == 0 {
+			t.Errorf("expect %s to receive requests, but got %v", addr, got)
+		}
+	}
+}
+
+func TestClientWithPassthroughResolver(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	s := &addrServer{}
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Test_serviceDesc, s)
+	s.addr = startServer(appCtx, h)
+	defer h.Drain()
+
+	for _, target := range []string{s.addr, "passthrough:///" + s.addr} {
+		c, err := lgrpc.NewClient(appCtx, target, grpc.WithInsecure())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p peer.Peer
+		res, err := NewTestClient(c.GRPC).Hello(
+			journey.New(appCtx), &Request{Msg: "Ping"}, grpc.Peer(&p),
+		)
+		c.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", target, err)
+		}
+		if res.Msg != s.addr || p.Addr.String() != s.addr {
+			t.Errorf("%s: expect to reach %s, but got %s", target, s.addr, res.Msg)
+		}
+	}
+}
+
+type addrServer struct {
+	addr string
+}
+
+func (s *addrServer) Hello(ctx context.Context, req *Request) (*Response, error) {
+	return &Response{Msg: s.addr}, nil
+}
+
+func splitAddr(t *testing.T, addr string) (string, uint16) {
+	i := strings.LastIndex(addr, ":")
+	port, err := strconv.ParseUint(addr[i+1:], 10, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr[:i], uint16(port)
+}
@@ -0,0 +1,63 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/stairlin/lego/circuit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CircuitBreaker returns a client middleware which sends RPCs through the
+// given breaker, with its timeout. Errors caused by the server or the network
+// count as failures, unlike client errors such as InvalidArgument or NotFound.
+//
+// RPCs rejected by the breaker fail with an Unavailable status, and RPCs which
+// time out fail with a DeadlineExceeded status.
+func CircuitBreaker(b *circuit.Breaker) UnaryClientMiddleware {
+	return func(next grpc.UnaryInvoker) grpc.UnaryInvoker {
+		return func(
+			ctx context.Context,
+			method string,
+			req, reply interface{},
+			cc *grpc.ClientConn,
+			opts ...grpc.CallOption,
+		) error {
+			var rpcErr error
+			err := b.Do(ctx, func(ctx context.Context) error {
+				rpcErr = next(ctx, method, req, reply, cc, opts...)
+				if isServerError(rpcErr) {
+					return rpcErr
+				}
+				return nil
+			}, nil)
+
+			switch err {
+			case nil:
+				return rpcErr
+			case circuit.ErrOpen, circuit.ErrMaxConcurrency:
+				return status.Error(codes.Unavailable, err.Error())
+			case circuit.ErrTimeout:
+				return status.Error(codes.DeadlineExceeded, err.Error())
+			case ctx.Err():
+				return status.FromContextError(err).Err()
+			}
+			return err
+		}
+	}
+}
+
+// isServerError tells whether err has been caused by the server or the network
+func isServerError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unknown,
+		codes.DeadlineExceeded,
+		codes.ResourceExhausted,
+		codes.Internal,
+		codes.Unavailable,
+		codes.DataLoss:
+		return true
+	}
+	return false
+}
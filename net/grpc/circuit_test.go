@@ -0,0 +1,49 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stairlin/lego/circuit"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+	appCtx.Circuit().Configure("test", circuit.WithVolumeThreshold(2))
+
+	var code codes.Code
+	invoker := lgrpc.CircuitBreaker(appCtx.Circuit().Get("test"))(func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		opts ...grpc.CallOption,
+	) error {
+		return status.Error(code, "boom")
+	})
+	call := func() codes.Code {
+		return status.Code(invoker(context.Background(), "/test/Hello", nil, nil, nil))
+	}
+
+	// Client errors do not count as failures
+	code = codes.NotFound
+	for i := 0; i < 4; i++ {
+		if c := call(); c != codes.NotFound {
+			t.Fatalf("expect NotFound, but got %s", c)
+		}
+	}
+
+	code = codes.Internal
+	for i := 0; i < 4; i++ {
+		call()
+	}
+	if c := call(); c != codes.Unavailable {
+		t.Errorf("expect circuit to be open, but got %s", c)
+	}
+}
@@ -9,7 +9,10 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stairlin/lego/ctx"
 	"github.com/stairlin/lego/ctx/app"
+	"github.com/stairlin/lego/ctx/journey"
 	"github.com/stairlin/lego/log"
+	"github.com/stairlin/lego/net/cert"
+	"github.com/stairlin/lego/net/retry"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
@@ -17,7 +20,8 @@ import (
 
 // Client is a wrapper for the grpc client.
 type Client struct {
-	unaryMiddlewares []UnaryClientMiddleware
+	unaryMiddlewares  []UnaryClientMiddleware
+	streamMiddlewares []StreamClientMiddleware
 
 	// HTTP is the standard net/http client
 	GRPC *grpc.ClientConn
@@ -28,6 +32,13 @@ type Client struct {
 	// sensitive information, so do not activate it for services that you
 	// don't trust.
 	PropagateContext bool
+	// Retry is the retry policy of idempotent RPCs (optional)
+	//
+	// RPCs must be marked with the Idempotent call option to be retried. They
+	// are retried on retryable codes (by default Unavailable), and the server
+	// pushback is respected. The policy can be overridden per call with the
+	// WithRetry call option.
+	Retry *retry.Policy
 }
 
 func NewClient(
@@ -36,9 +47,12 @@ func NewClient(
 	appCtx.Trace("c.grpc.dial", "Dialing...", log.String("target", target))
 	client := &Client{}
 
-	// Add default dial options
+	// Add default dial options. Resolvers given by the caller take precedence
+	// over the default ones.
 	opts = append(opts,
 		grpc.WithUnaryInterceptor(client.unaryInterceptor),
+		grpc.WithStreamInterceptor(client.streamInterceptor),
+		WithResolvers(appCtx),
 	)
 
 	// Dial GRPC connection
@@ -116,6 +130,15 @@ func WithMutualTLS(
 	return grpc.WithTransportCredentials(creds), nil
 }
 
+// WithCertManager returns a dial option for the GRPC client that activates
+// TLS with the certificates served by m. Certificates are reloaded by m
+// without having to dial again.
+func WithCertManager(m *cert.Manager, serverName string) grpc.DialOption {
+	return grpc.WithTransportCredentials(
+		credentials.NewTLS(m.ClientConfig(serverName)),
+	)
+}
+
 // MustDialOption panics if it receives an error
 func MustDialOption(opt grpc.DialOption, err error) grpc.DialOption {
 	if err != nil {
@@ -135,6 +158,7 @@ func (c *Client) unaryInterceptor(
 	invoker grpc.UnaryInvoker,
 	opts ...grpc.CallOption,
 ) error {
+	j, _ := ctx.(journey.Ctx)
 	if c.PropagateContext {
 		var err error
 		ctx, err = EmbedContext(ctx)
@@ -148,7 +172,7 @@ func (c *Client) unaryInterceptor(
 	for i := len(c.unaryMiddlewares) - 1; i >= 0; i-- {
 		next = c.unaryMiddlewares[i](next)
 	}
-	return next(ctx, method, req, reply, cc, opts...)
+	return c.invokeWithRetry(ctx, j, next, method, req, reply, cc, opts...)
 }
 
 type UnaryClientMiddleware func(grpc.UnaryInvoker) grpc.UnaryInvoker
@@ -16,7 +16,9 @@ const contextMD = "lego-journey-bin"
 var ErrMissingJourney = errors.New("missing journey")
 
 // ExtractContext extracts journey from a generic context
-func ExtractContext(context context.Context, app app.Ctx) (journey.Ctx, error) {
+func ExtractContext(
+	context context.Context, app app.Ctx, o ...journey.Option,
+) (journey.Ctx, error) {
 	md, ok := metadata.FromIncomingContext(context)
 	if !ok {
 		return nil, errors.New("missing metadata")
@@ -25,7 +27,7 @@ func ExtractContext(context context.Context, app app.Ctx) (journey.Ctx, error) {
 	if !ok {
 		return nil, ErrMissingJourney
 	}
-	ctx, err := journey.UnmarshalGob(app, []byte(data[0]))
+	ctx, err := journey.UnmarshalGob(app, []byte(data[0]), o...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal Context")
 	}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +12,8 @@ import (
 	lgrpc "github.com/stairlin/lego/net/grpc"
 	lt "github.com/stairlin/lego/testing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestClientServer(t *testing.T) {
@@ -188,10 +189,8 @@ func TestDrain(t *testing.T) {
 	if err == nil {
 		t.Fatal("expect to get an error when the server is drained")
 	}
-	if !strings.Contains(err.Error(), "grpc: the connection is unavailable") &&
-		!strings.Contains(err.Error(), "transport is closing") &&
-		!strings.Contains(err.Error(), "all SubConns are in TransientFailure") {
-		t.Errorf("unexpected error %s", err)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expect error code Unavailable, but got %s", err)
 	}
 }
 
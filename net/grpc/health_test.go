@@ -0,0 +1,63 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestHealth(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Test_serviceDesc, &funcServer{})
+	h.ActivateChannelz()
+	addr := startServer(appCtx, h)
+
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	client := healthpb.NewHealthClient(c.GRPC)
+
+	for _, service := range []string{"", "grpc_test.Test", "grpc.channelz.v1.Channelz"} {
+		res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{
+			Service: service,
+		})
+		if err != nil {
+			t.Fatalf("expect health check of %q to succeed (%s)", service, err)
+		}
+		if res.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("expect %q to be SERVING, but got %s", service, res.Status)
+		}
+	}
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: "grpc_test.Unknown",
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expect NotFound for an unknown service, but got %v", err)
+	}
+
+	// Draining reports every service as not serving
+	h.Drain()
+	for _, service := range []string{"", "grpc_test.Test"} {
+		res, err := h.Health.Check(context.Background(), &healthpb.HealthCheckRequest{
+			Service: service,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("expect %q to be NOT_SERVING, but got %s", service, res.Status)
+		}
+	}
+}
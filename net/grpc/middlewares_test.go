@@ -0,0 +1,170 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/ctx/app"
+	"github.com/stairlin/lego/ctx/journey"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	tt := lt.New(t)
+	tt.DisableStrictMode()
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	client, stop := startFuncServer(t, appCtx, func(ctx context.Context) (*Response, error) {
+		panic("boom")
+	})
+	defer stop()
+	_, err := client.Hello(journey.New(appCtx), &Request{Msg: "Ping"})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expect Internal, but got %v", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+	appCtx.Config().Request.TimeoutMS = 20
+
+	client, stop := startFuncServer(t, appCtx, func(ctx context.Context) (*Response, error) {
+		time.Sleep(200 * time.Millisecond)
+		return &Response{Msg: "Pong"}, nil
+	})
+	defer stop()
+	start := time.Now()
+	_, err := client.Hello(journey.New(appCtx), &Request{Msg: "Ping"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expect DeadlineExceeded, but got %v", err)
+	}
+	if time.Since(start) > 150*time.Millisecond {
+		t.Errorf("expect RPC to be interrupted, but it took %s", time.Since(start))
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	client, stop := startFuncServer(t, appCtx, func(ctx context.Context) (*Response, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expect journey to have the client deadline")
+		}
+		return &Response{Msg: "Pong"}, nil
+	})
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Hello(ctx, &Request{Msg: "Ping"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type funcServer struct {
+	f func(ctx context.Context) (*Response, error)
+}
+
+func (s *funcServer) Hello(ctx context.Context, req *Request) (*Response, error) {
+	return s.f(ctx)
+}
+
+// startFuncServer starts a server which handles calls with f, and returns
+// a client connected to it, and a function which stops both
+func startFuncServer(
+	t *testing.T, appCtx app.Ctx, f func(ctx context.Context) (*Response, error),
+) (TestClient, func()) {
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Test_serviceDesc, &funcServer{f: f})
+	addr := startServer(appCtx, h)
+
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTestClient(c.GRPC), func() {
+		c.Close()
+		h.Drain()
+	}
+}
+
+func TestDrainRejection(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Test_serviceDesc, &funcServer{
+		f: func(ctx context.Context) (*Response, error) {
+			started <- struct{}{}
+			<-release
+			return &Response{Msg: "Pong"}, nil
+		},
+	})
+	addr := startServer(appCtx, h)
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	client := NewTestClient(c.GRPC)
+
+	// Keep an RPC in flight, so that draining waits for it
+	inflight := make(chan error, 1)
+	go func() {
+		_, err := client.Hello(journey.New(appCtx), &Request{Msg: "Ping"})
+		inflight <- err
+	}()
+	<-started
+	go h.Drain()
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = client.Hello(journey.New(appCtx), &Request{Msg: "Ping"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expect Unavailable while draining, but got %v", err)
+	}
+	close(release)
+	if err := <-inflight; err != nil {
+		t.Error("expect in-flight RPC to complete", err)
+	}
+}
+
+func TestUnaryMiddlewareMethod(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Test_serviceDesc, &funcServer{
+		f: func(ctx context.Context) (*Response, error) {
+			return &Response{Msg: "Pong"}, nil
+		},
+	})
+	methods := make(chan string, 1)
+	h.AppendUnaryMiddleware(func(next lgrpc.UnaryHandler) lgrpc.UnaryHandler {
+		return func(ctx journey.Ctx, req interface{}) (interface{}, error) {
+			methods <- ctx.Load("Method").(string)
+			return next(ctx, req)
+		}
+	})
+	addr := startServer(appCtx, h)
+	defer h.Drain()
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := NewTestClient(c.GRPC).Hello(journey.New(appCtx), &Request{Msg: "Ping"}); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-methods; m != "/grpc_test.Test/Hello" {
+		t.Errorf("expect method /grpc_test.Test/Hello, but got %s", m)
+	}
+}
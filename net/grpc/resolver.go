@@ -2,60 +2,177 @@ package grpc
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
+	"github.com/stairlin/lego/ctx/app"
+	"github.com/stairlin/lego/disco"
 	lego "github.com/stairlin/lego/net/naming"
-	grpc "google.golang.org/grpc/naming"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
 )
 
-// WrapResolver wraps a lego resolver with a gRPC resolver
-func WrapResolver(r lego.Resolver) grpc.Resolver {
-	return &resolver{r: r}
+// schemes contains the naming schemes resolved by lego for gRPC clients
+var schemes = []string{"dns", "disco", "passthrough"}
+
+// WeightKey is the address attribute key of the instance weight
+type WeightKey struct{}
+
+// MetaKey is the address attribute key of an instance metadata entry
+type MetaKey string
+
+// ResolverOption configures the resolvers returned by Resolvers
+type ResolverOption func(*ResolverOptions)
+
+// ResolverOptions contains the resolver options
+type ResolverOptions struct {
+	// ServiceConfig is the JSON service config pushed along with addresses
+	ServiceConfig string
+}
+
+// WithServiceConfig pushes the given JSON service config along with the
+// resolved addresses
+func WithServiceConfig(json string) ResolverOption {
+	return func(o *ResolverOptions) {
+		o.ServiceConfig = json
+	}
 }
 
-type resolver struct {
-	r lego.Resolver
+// WithLoadBalancingPolicy pushes a service config which selects the given
+// load balancing policy (e.g. round_robin)
+func WithLoadBalancingPolicy(name string) ResolverOption {
+	return WithServiceConfig(lbConfig(name))
 }
 
-func (r *resolver) Resolve(target string) (grpc.Watcher, error) {
-	w, err := r.r.Resolve(target)
-	if err != nil {
-		return nil, err
+// Resolvers returns gRPC resolver builders for the dns, disco and passthrough
+// schemes, backed by the naming package. NewClient uses them by default.
+func Resolvers(ctx app.Ctx, o ...ResolverOption) []resolver.Builder {
+	opts := ResolverOptions{}
+	for _, f := range o {
+		f(&opts)
 	}
-	return &watcher{w: w}, nil
+
+	builders := make([]resolver.Builder, len(schemes))
+	for i, scheme := range schemes {
+		builders[i] = &resolverBuilder{ctx: ctx, scheme: scheme, opts: opts}
+	}
+	return builders
+}
+
+// WithResolvers returns a dial option which resolves the dns, disco and
+// passthrough schemes with the naming package
+func WithResolvers(ctx app.Ctx, o ...ResolverOption) grpc.DialOption {
+	return grpc.WithResolvers(Resolvers(ctx, o...)...)
+}
+
+// resolverBuilder implements resolver.Builder for a naming scheme
+type resolverBuilder struct {
+	ctx    app.Ctx
+	scheme string
+	opts   ResolverOptions
 }
 
-type watcher struct {
-	w lego.Watcher
+func (b *resolverBuilder) Scheme() string {
+	return b.scheme
 }
 
-func (w *watcher) Next() ([]*grpc.Update, error) {
-	res, err := w.w.Next()
+func (b *resolverBuilder) Build(
+	target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	w, err := lego.Resolve(b.ctx, target.URL.String())
 	if err != nil {
 		return nil, err
 	}
 
-	var updates []*grpc.Update
-	for _, u := range res {
-		switch u.Op {
-		case lego.Add:
-			updates = append(updates, &grpc.Update{
-				Op:       grpc.Add,
-				Addr:     u.Addr,
-				Metadata: u.Metadata,
-			})
-		case lego.Delete:
-			updates = append(updates, &grpc.Update{
-				Op:       grpc.Delete,
-				Addr:     u.Addr,
-				Metadata: u.Metadata,
-			})
-		default:
-			return nil, fmt.Errorf("net/grpc: unsupported naming op %d", u.Op)
+	r := &namingResolver{
+		w:     w,
+		cc:    cc,
+		addrs: map[string]resolver.Address{},
+		done:  make(chan struct{}),
+	}
+	if b.opts.ServiceConfig != "" && !opts.DisableServiceConfig {
+		r.sc = cc.ParseServiceConfig(b.opts.ServiceConfig)
+	}
+	go r.watch()
+	return r, nil
+}
+
+// namingResolver pushes the updates of a naming watcher to gRPC
+type namingResolver struct {
+	w  lego.Watcher
+	cc resolver.ClientConn
+	sc *serviceconfig.ParseResult
+
+	addrs map[string]resolver.Address
+	once  sync.Once
+	done  chan struct{}
+}
+
+// ResolveNow is a no-op, since watchers push their updates
+func (r *namingResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *namingResolver) Close() {
+	r.once.Do(func() {
+		r.w.Close()
+	})
+	<-r.done
+}
+
+func (r *namingResolver) watch() {
+	defer close(r.done)
+
+	for {
+		updates, err := r.w.Next()
+		if err == lego.ErrWatcherClosed {
+			return
+		}
+		if err != nil {
+			r.cc.ReportError(err)
+			return
+		}
+
+		for _, u := range updates {
+			switch u.Op {
+			case lego.Add:
+				r.addrs[u.Addr] = address(u)
+			case lego.Delete:
+				delete(r.addrs, u.Addr)
+			}
 		}
+		r.cc.UpdateState(r.state())
+	}
+}
+
+func (r *namingResolver) state() resolver.State {
+	addrs := make([]resolver.Address, 0, len(r.addrs))
+	for _, a := range r.addrs {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	return resolver.State{Addresses: addrs, ServiceConfig: r.sc}
+}
+
+// address converts a naming update to a gRPC address. The metadata and weight
+// of disco instances are attached as attributes.
+func address(u *lego.Update) resolver.Address {
+	a := resolver.Address{Addr: u.Addr}
+	i, ok := u.Metadata.(*disco.Instance)
+	if !ok {
+		return a
+	}
+
+	attrs := attributes.New(WeightKey{}, i.Weight)
+	for k, v := range i.Meta {
+		attrs = attrs.WithValue(MetaKey(k), v)
 	}
-	return updates, nil
+	a.Attributes = attrs
+	return a
 }
 
-func (w *watcher) Close() {
-	w.w.Close() // Igrpcore error
+func lbConfig(name string) string {
+	return fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, name)
 }
@@ -0,0 +1,95 @@
+package grpc_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/disco"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+func TestDiscoResolver(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	var builder resolver.Builder
+	for _, b := range lgrpc.Resolvers(appCtx, lgrpc.WithLoadBalancingPolicy("round_robin")) {
+		if b.Scheme() == "disco" {
+			builder = b
+		}
+	}
+	if builder == nil {
+		t.Fatal("expect a disco resolver")
+	}
+
+	cc := &clientConn{states: make(chan resolver.State, 8)}
+	target := resolver.Target{URL: url.URL{Scheme: "disco", Host: "payments"}}
+	r, err := builder.Build(target, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if s := cc.next(t); len(s.Addresses) != 0 {
+		t.Errorf("expect no addresses, but got %v", s.Addresses)
+	}
+	if cc.sc != `{"loadBalancingConfig":[{"round_robin":{}}]}` {
+		t.Errorf("expect round_robin service config, but got %s", cc.sc)
+	}
+
+	_, err = appCtx.Disco().Register(appCtx, &disco.Registration{
+		Name:   "payments",
+		Addr:   "10.0.0.1",
+		Port:   3000,
+		Meta:   map[string]string{"az": "eu-1"},
+		Weight: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cc.next(t)
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "10.0.0.1:3000" {
+		t.Fatalf("expect 10.0.0.1:3000, but got %v", s.Addresses)
+	}
+	attrs := s.Addresses[0].Attributes
+	if w := attrs.Value(lgrpc.WeightKey{}); w != 5 {
+		t.Errorf("expect weight attribute to be 5, but got %v", w)
+	}
+	if az := attrs.Value(lgrpc.MetaKey("az")); az != "eu-1" {
+		t.Errorf("expect az attribute to be eu-1, but got %v", az)
+	}
+	if s.ServiceConfig == nil {
+		t.Error("expect service config to be pushed with the state")
+	}
+}
+
+// clientConn records the states pushed by a resolver
+type clientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+	sc     string
+}
+
+func (c *clientConn) UpdateState(s resolver.State) error {
+	c.states <- s
+	return nil
+}
+
+func (c *clientConn) ParseServiceConfig(json string) *serviceconfig.ParseResult {
+	c.sc = json
+	return &serviceconfig.ParseResult{}
+}
+
+func (c *clientConn) next(t *testing.T) resolver.State {
+	select {
+	case s := <-c.states:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect resolver to push a state")
+	}
+	return resolver.State{}
+}
@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/log"
+	"github.com/stairlin/lego/net/retry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// pushbackMD is the trailer with which servers can ask clients to wait
+// before retrying (in milliseconds), or not to retry (negative value)
+const pushbackMD = "grpc-retry-pushback-ms"
+
+// retryableCodes contains the codes retried by default
+var retryableCodes = []int{int(codes.Unavailable)}
+
+// WithRetry returns a call option which overrides the retry policy of the
+// client. A nil policy disables retries.
+func WithRetry(p *retry.Policy) grpc.CallOption {
+	return &retryOption{p: p}
+}
+
+// Idempotent returns a call option which marks an RPC as idempotent, so that
+// it can be retried
+func Idempotent() grpc.CallOption {
+	return &idempotentOption{}
+}
+
+type retryOption struct {
+	grpc.EmptyCallOption
+	p *retry.Policy
+}
+
+type idempotentOption struct {
+	grpc.EmptyCallOption
+}
+
+// invokeWithRetry calls next until it succeeds or the retry policy gives up
+func (c *Client) invokeWithRetry(
+	ctx context.Context,
+	j journey.Ctx,
+	next grpc.UnaryInvoker,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	opts ...grpc.CallOption,
+) error {
+	p := retry.FromContext(ctx, c.Retry)
+	var idempotent bool
+	for _, o := range opts {
+		switch o := o.(type) {
+		case *retryOption:
+			p = o.p
+		case *idempotentOption:
+			idempotent = true
+		}
+	}
+	if p == nil || !idempotent {
+		return next(ctx, method, req, reply, cc, opts...)
+	}
+
+	for attempt := 1; ; attempt++ {
+		var trailer metadata.MD
+		err := next(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+
+		d, ok := retryDelay(ctx, p, attempt, err, trailer)
+		if !ok {
+			if !p.Retryable(int(status.Code(err)), retryableCodes...) {
+				p.Success()
+			}
+			return err
+		}
+
+		code := status.Code(err).String()
+		if j != nil {
+			j.Trace("grpc.client.retry", "Retry RPC",
+				log.String("method", method),
+				log.String("code", code),
+				log.Duration("delay", d),
+			)
+			j.Stats().Inc("grpc.client.retry", map[string]string{
+				"method": method,
+				"code":   code,
+			})
+		}
+		if err := retry.Sleep(ctx, d); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+}
+
+// retryDelay returns the delay before retrying an RPC, and whether it can be
+// retried at all
+func retryDelay(
+	ctx context.Context,
+	p *retry.Policy,
+	attempt int,
+	err error,
+	trailer metadata.MD,
+) (time.Duration, bool) {
+	if err == nil || attempt >= p.Attempts() || ctx.Err() != nil {
+		return 0, false
+	}
+	if !p.Retryable(int(status.Code(err)), retryableCodes...) {
+		return 0, false
+	}
+
+	d := p.Backoff(attempt)
+	if v := trailer.Get(pushbackMD); len(v) > 0 {
+		ms, perr := strconv.Atoi(v[0])
+		if perr != nil || ms < 0 {
+			return 0, false
+		}
+		d = time.Duration(ms) * time.Millisecond
+	}
+	return d, p.Allow(ctx, d)
+}
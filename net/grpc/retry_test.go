@@ -0,0 +1,64 @@
+package grpc_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/ctx/journey"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	"github.com/stairlin/lego/net/retry"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientWithRetryPolicy(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+
+	s := &flakyServer{failures: 2}
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Test_serviceDesc, s)
+	addr := startServer(appCtx, h)
+	defer h.Drain()
+
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Retry = &retry.Policy{MaxAttempts: 3, MinBackoff: time.Millisecond}
+	client := NewTestClient(c.GRPC)
+
+	// RPCs which are not idempotent are not retried
+	_, err = client.Hello(journey.New(appCtx), &Request{Msg: "Ping"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expect Unavailable, but got %v", err)
+	}
+
+	_, err = client.Hello(journey.New(appCtx), &Request{Msg: "Ping"},
+		lgrpc.Idempotent(),
+	)
+	if err != nil {
+		t.Error("expect RPC to succeed after a retry", err)
+	}
+	if n := atomic.LoadInt32(&s.calls); n != 3 {
+		t.Errorf("expect 3 calls, but got %d", n)
+	}
+}
+
+// flakyServer fails the first calls with Unavailable
+type flakyServer struct {
+	failures int32
+	calls    int32
+}
+
+func (s *flakyServer) Hello(ctx context.Context, req *Request) (*Response, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "not yet")
+	}
+	return &Response{Msg: "Pong"}, nil
+}
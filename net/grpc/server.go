@@ -2,22 +2,27 @@ package grpc
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"fmt"
-	"io/ioutil"
 	"net"
+	"runtime/debug"
+	"strings"
 	"sync/atomic"
 	"time"
 
-	"github.com/pkg/errors"
+	"github.com/golang/protobuf/proto"
 	"github.com/stairlin/lego/ctx/app"
 	"github.com/stairlin/lego/ctx/journey"
 	"github.com/stairlin/lego/log"
 	lnet "github.com/stairlin/lego/net"
+	"github.com/stairlin/lego/net/cert"
 	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 // A Server defines parameters for running a lego compatible GRPC server
@@ -25,31 +30,47 @@ type Server struct {
 	mode uint32
 	addr string
 
-	opts             []grpc.ServerOption
-	registrations    []registration
-	services         []service
-	unaryMiddlewares []UnaryServerMiddleware
+	opts              []grpc.ServerOption
+	registrations     []registration
+	services          []service
+	unaryMiddlewares  []UnaryServerMiddleware
+	streamMiddlewares []StreamServerMiddleware
 
-	creds grpc.ServerOption
+	certSource cert.Source
+	mutualTLS  bool
+	channelz   bool
 
 	app app.Ctx
 
-	GRPC *grpc.Server
+	GRPC   *grpc.Server
+	Health *health.Server
 }
 
 // NewServer creates a new GRPC server
 func NewServer() *Server {
-	return &Server{
-		unaryMiddlewares: []UnaryServerMiddleware{
-			mwServerLogging,
-			mwServerStats,
-		},
+	s := &Server{}
+	s.unaryMiddlewares = []UnaryServerMiddleware{
+		s.mwServerDrain,
+		mwServerPanic,
+		mwServerLogging,
+		mwServerStats,
+		mwServerDeadline,
 	}
+	s.streamMiddlewares = []StreamServerMiddleware{
+		s.mwServerStreamDrain,
+		mwServerStreamPanic,
+		mwServerStreamLogging,
+		mwServerStreamStats,
+	}
+	return s
 }
 
 // Handle just injects the GRPC server to register a service. The function
 // is called back only when Serve is called. This must be called before
 // invoking Serve.
+//
+// Services registered this way are not returned by ServiceInfo, so they can
+// neither be invoked with Invoke nor exposed by the HTTP gateway.
 func (s *Server) Handle(f func(*grpc.Server)) {
 	s.registrations = append(s.registrations, f)
 }
@@ -73,6 +94,18 @@ func (s *Server) AppendUnaryMiddleware(m UnaryServerMiddleware) {
 	s.unaryMiddlewares = append(s.unaryMiddlewares, m)
 }
 
+// AppendStreamMiddleware appends a stream middleware to the call chain
+func (s *Server) AppendStreamMiddleware(m StreamServerMiddleware) {
+	s.streamMiddlewares = append(s.streamMiddlewares, m)
+}
+
+// ActivateChannelz registers the channelz service, which exposes runtime
+// information about channels, servers and sockets. This must be called before
+// invoking Serve.
+func (s *Server) ActivateChannelz() {
+	s.channelz = true
+}
+
 // ActivateTLS activates TLS on this handler. That means only incoming TLS
 // connections are allowed.
 //
@@ -80,14 +113,10 @@ func (s *Server) AppendUnaryMiddleware(m UnaryServerMiddleware) {
 // be the concatenation of the server's certificate, any intermediates,
 // and the CA's certificate.
 //
-// Clients are not authenticated.
+// Clients are not authenticated. Files are reloaded periodically, so that
+// certificates can be rotated.
 func (s *Server) ActivateTLS(certFile, keyFile string) {
-	// Create the TLS credentials
-	creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
-	if err != nil {
-		panic(err)
-	}
-	s.creds = grpc.Creds(creds)
+	s.ActivateTLSSource(cert.Files(certFile, keyFile, ""))
 }
 
 // ActivateMutualTLS activates TLS on this handler. That means only incoming TLS
@@ -97,45 +126,57 @@ func (s *Server) ActivateTLS(certFile, keyFile string) {
 // If the certificate is signed by a certificate authority, the certFile should
 // be the concatenation of the server's certificate, any intermediates,
 // and the CA's certificate.
+//
+// Files are reloaded periodically, so that certificates can be rotated.
 func (s *Server) ActivateMutualTLS(certFile, keyFile, caFile string) {
-	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		panic(errors.Wrap(err, "could not load server key pair"))
-	}
+	s.ActivateMutualTLSSource(cert.Files(certFile, keyFile, caFile))
+}
 
-	// Create a certificate pool from the certificate authority
-	certPool := x509.NewCertPool()
-	ca, err := ioutil.ReadFile(caFile)
-	if err != nil {
-		panic(errors.Wrap(err, "could not read ca certificate"))
-	}
-	if ok := certPool.AppendCertsFromPEM(ca); !ok {
-		panic(errors.Wrap(err, "failed to append client certs"))
-	}
+// ActivateTLSSource activates TLS on this handler with a certificate loaded
+// from src, which is reloaded periodically.
+func (s *Server) ActivateTLSSource(src cert.Source) {
+	s.certSource = src
+	s.mutualTLS = false
+}
 
-	creds := credentials.NewTLS(&tls.Config{
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		Certificates: []tls.Certificate{certificate},
-		ClientCAs:    certPool,
-	})
-	s.creds = grpc.Creds(creds)
+// ActivateMutualTLSSource activates mutual TLS on this handler with a
+// certificate and certificate authorities loaded from src, which are reloaded
+// periodically.
+func (s *Server) ActivateMutualTLSSource(src cert.Source) {
+	s.certSource = src
+	s.mutualTLS = true
 }
 
-// Serve starts serving HTTP requests (blocking call)
+// Serve starts serving gRPC requests (blocking call)
 func (s *Server) Serve(addr string, ctx app.Ctx) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(lis, ctx)
+}
+
+// ServeListener starts serving gRPC requests on connections accepted by lis
+// (blocking call)
+func (s *Server) ServeListener(lis net.Listener, ctx app.Ctx) error {
 	s.app = ctx
 	defer atomic.StoreUint32(&s.mode, lnet.StateDown)
 
-	// Register interceptor
-	s.opts = append(s.opts, grpc.UnaryInterceptor(s.unaryInterceptor))
+	// Register interceptors
+	s.opts = append(s.opts,
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	)
 
-	tlsEnabled := s.creds != nil
+	tlsEnabled := s.certSource != nil
 	if tlsEnabled {
-		s.SetOptions(s.creds)
+		m := cert.NewManager(s.certSource, ctx.L(), ctx.Stats())
+		defer m.Close()
+		s.SetOptions(grpc.Creds(credentials.NewTLS(m.ServerConfig(s.mutualTLS))))
 	}
 
 	s.GRPC = grpc.NewServer(s.opts...)
-	s.addr = addr
+	s.addr = lis.Addr().String()
 
 	// Register endpoints/services
 	for _, registration := range s.registrations {
@@ -145,20 +186,25 @@ func (s *Server) Serve(addr string, ctx app.Ctx) error {
 		s.GRPC.RegisterService(service.sd, service.ss)
 	}
 
-	// Register reflection service on gRPC server
+	// Register reflection, health and admin services on gRPC server
 	reflection.Register(s.GRPC)
-
-	lis, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
+	s.Health = health.NewServer()
+	healthpb.RegisterHealthServer(s.GRPC, s.Health)
+	if s.channelz {
+		channelz.RegisterChannelzServiceToServer(s.GRPC)
+	}
+	s.Health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	for name := range s.GRPC.GetServiceInfo() {
+		s.Health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
 	}
 
 	ctx.Trace("s.grpc.listen", "Listening...",
-		log.String("addr", addr),
+		log.String("addr", s.addr),
 		log.Bool("tls", tlsEnabled),
 	)
 	atomic.StoreUint32(&s.mode, lnet.StateUp)
-	err = s.GRPC.Serve(lis)
+	s.Health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	err := s.GRPC.Serve(lis)
 	switch err := err.(type) {
 	case *net.OpError:
 		if err.Op == "accept" && s.isDraining() {
@@ -168,9 +214,11 @@ func (s *Server) Serve(addr string, ctx app.Ctx) error {
 	return err
 }
 
-// Drain puts the handler into drain mode.
+// Drain puts the handler into drain mode. All services are reported as
+// NOT_SERVING by the health service before the server stops gracefully.
 func (s *Server) Drain() {
 	atomic.StoreUint32(&s.mode, lnet.StateDrain)
+	s.Health.Shutdown()
 	s.GRPC.GracefulStop()
 }
 
@@ -185,35 +233,120 @@ func (s *Server) unaryInterceptor(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
+	ctx, err := s.newJourney(context)
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.End()
+	ctx.Store("Method", info.FullMethod)
+
+	return s.buildUnaryChain(handler)(ctx, req)
+}
+
+// buildUnaryChain builds the unary middleware chain around handler
+func (s *Server) buildUnaryChain(handler grpc.UnaryHandler) UnaryHandler {
+	next := UnaryHandler(func(ctx journey.Ctx, req interface{}) (interface{}, error) {
+		return handler(ctx, req)
+	})
+	for i := len(s.unaryMiddlewares) - 1; i >= 0; i-- {
+		next = s.unaryMiddlewares[i](next)
+	}
+	return next
+}
+
+// ServiceInfo returns the services registered with RegisterService, keyed by
+// service name. Services registered with Handle are not included.
+func (s *Server) ServiceInfo() map[string]grpc.ServiceInfo {
+	m := make(map[string]grpc.ServiceInfo, len(s.services))
+	for _, service := range s.services {
+		info := grpc.ServiceInfo{Metadata: service.sd.Metadata}
+		for _, method := range service.sd.Methods {
+			info.Methods = append(info.Methods, grpc.MethodInfo{
+				Name: method.MethodName,
+			})
+		}
+		for _, stream := range service.sd.Streams {
+			info.Methods = append(info.Methods, grpc.MethodInfo{
+				Name:           stream.StreamName,
+				IsClientStream: stream.ClientStreams,
+				IsServerStream: stream.ServerStreams,
+			})
+		}
+		m[service.sd.ServiceName] = info
+	}
+	return m
+}
+
+// Invoke calls an unary method of a service registered with RegisterService
+// in-process. The request message is decoded by dec, and the call goes through
+// the unary middleware chain with ctx as its journey.
+//
+// It allows other transports, such as an HTTP gateway, to serve RPCs without
+// a network round-trip.
+func (s *Server) Invoke(
+	ctx journey.Ctx, fullMethod string, dec func(interface{}) error,
+) (interface{}, error) {
+	name, method := splitMethod(fullMethod)
+	for _, service := range s.services {
+		if service.sd.ServiceName != name {
+			continue
+		}
+		for _, m := range service.sd.Methods {
+			if m.MethodName != method {
+				continue
+			}
+			ctx.Store("Start-Time", time.Now().UnixNano())
+			ctx.Store("Method", fullMethod)
+			return m.Handler(service.ss, ctx, dec, func(
+				_ context.Context,
+				req interface{},
+				_ *grpc.UnaryServerInfo,
+				handler grpc.UnaryHandler,
+			) (interface{}, error) {
+				return s.buildUnaryChain(handler)(ctx, req)
+			})
+		}
+	}
+	return nil, status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+}
+
+// newJourney returns the journey of an incoming RPC. It is extracted from the
+// metadata when the config allows it, and it is cancelled at the deadline set
+// by the client.
+func (s *Server) newJourney(
+	context context.Context, o ...journey.Option,
+) (journey.Ctx, error) {
+	incoming := context
 	if s.app.Config().Request.AllowContext {
 		var err error
-		context, err = ExtractContext(context, s.app)
+		context, err = ExtractContext(context, s.app, o...)
 		switch err {
 		case ErrMissingJourney:
 			// TODO: Create journey from generic context
-			context = journey.New(s.app)
+			context = journey.New(s.app, o...)
 		case nil:
 		default:
 			return nil, err
 		}
 	} else {
 		// TODO: Create journey from generic context
-		context = journey.New(s.app)
+		context = journey.New(s.app, o...)
 	}
 	ctx := context.(journey.Ctx)
-	ctx.Store("Start-Time", time.Now().UnixNano())
-
-	// Build middleware chain and then call it
-	next := func(ctx journey.Ctx, req interface{}) (interface{}, error) {
-		return handler(ctx, req)
+	if deadline, ok := incoming.Deadline(); ok {
+		ctx = journey.WithDeadline(ctx, deadline)
 	}
-	for i := len(s.unaryMiddlewares) - 1; i >= 0; i-- {
-		next = s.unaryMiddlewares[i](next)
+	ctx.Store("Start-Time", time.Now().UnixNano())
+	if p, ok := peer.FromContext(incoming); ok {
+		ctx.Store("Peer", p.Addr.String())
 	}
-	return next(ctx, req)
+	return ctx, nil
 }
 
+// UnaryHandler handles an unary RPC
 type UnaryHandler func(ctx journey.Ctx, req interface{}) (interface{}, error)
+
+// UnaryServerMiddleware is a function called on the unary RPC stack
 type UnaryServerMiddleware func(next UnaryHandler) UnaryHandler
 
 type registration func(s *grpc.Server)
@@ -223,42 +356,167 @@ type service struct {
 	ss interface{}
 }
 
-// mwServerLogging logs information about HTTP requests/responses
+// mwServerLogging logs information about RPC requests/responses
 func mwServerLogging(next UnaryHandler) UnaryHandler {
 	return func(ctx journey.Ctx, req interface{}) (interface{}, error) {
+		service, method := splitMethod(fullMethod(ctx))
 		ctx.Trace("h.grpc.req.start", "Request start",
-			log.Type("req", req),
+			log.String("service", service),
+			log.String("method", method),
+			log.String("peer", peerAddr(ctx)),
+			log.Int("req_size", msgSize(req)),
 		)
 
 		// Next middleware
 		res, err := next(ctx, req)
 
-		startTime := ctx.Load("Start-Time").(int64)
-		duration := time.Duration(time.Now().UnixNano() - startTime)
 		ctx.Trace("h.grpc.req.end", "Request end",
-			log.Duration("duration", duration),
+			log.Stringer("code", status.Code(err)),
+			log.Duration("duration", elapsed(ctx)),
+			log.Int("res_size", msgSize(res)),
 			log.Error(err),
 		)
 		return res, err
 	}
 }
 
-// mwServerStats sends the request/response stats
+// mwServerStats sends the request/response stats. Metric names and tags
+// mirror those of the HTTP server, with the code as status.
 func mwServerStats(next UnaryHandler) UnaryHandler {
 	return func(ctx journey.Ctx, req interface{}) (interface{}, error) {
+		service, method := splitMethod(fullMethod(ctx))
 		tags := map[string]string{
-			"req": fmt.Sprintf("%T", req),
+			"service": service,
+			"method":  method,
 		}
 		ctx.Stats().Inc("grpc.conc", tags)
 
 		// Next middleware
 		res, err := next(ctx, req)
 
-		startTime := ctx.Load("Start-Time").(int64)
-		duration := time.Duration(time.Now().UnixNano() - startTime)
-		ctx.Stats().Histogram("grpc.call", 1, tags)
-		ctx.Stats().Timing("grpc.time", duration, tags)
 		ctx.Stats().Dec("grpc.conc", tags)
+		tags["status"] = status.Code(err).String()
+		ctx.Stats().Histogram("grpc.call", 1, tags)
+		ctx.Stats().Timing("grpc.time", elapsed(ctx), tags)
+		ctx.Stats().Histogram("grpc.req.size", msgSize(req), tags)
+		if err == nil {
+			ctx.Stats().Histogram("grpc.res.size", msgSize(res), tags)
+		}
 		return res, err
 	}
 }
+
+// mwServerDrain rejects RPCs while the server is draining
+func (s *Server) mwServerDrain(next UnaryHandler) UnaryHandler {
+	return func(ctx journey.Ctx, req interface{}) (interface{}, error) {
+		if s.isDraining() {
+			ctx.Trace("grpc.draining", "Server is draining")
+			return nil, errDraining
+		}
+		return next(ctx, req)
+	}
+}
+
+// mwServerPanic catches panics and turns them into Internal errors
+func mwServerPanic(next UnaryHandler) UnaryHandler {
+	return func(ctx journey.Ctx, req interface{}) (res interface{}, err error) {
+		defer func() {
+			if ctx.AppConfig().Request.Panic {
+				return
+			}
+			if recover := recover(); recover != nil {
+				err = recovered(ctx, recover)
+			}
+		}()
+		return next(ctx, req)
+	}
+}
+
+// mwServerDeadline interrupts RPCs once the journey is done, which happens
+// when the configured request timeout or the client deadline expires
+func mwServerDeadline(next UnaryHandler) UnaryHandler {
+	return func(ctx journey.Ctx, req interface{}) (interface{}, error) {
+		type result struct {
+			res interface{}
+			err error
+		}
+		c := make(chan result, 1)
+
+		go func() {
+			defer func() {
+				if ctx.AppConfig().Request.Panic {
+					return
+				}
+				if recover := recover(); recover != nil {
+					c <- result{err: recovered(ctx, recover)}
+				}
+			}()
+
+			res, err := next(ctx, req)
+			c <- result{res: res, err: err}
+		}()
+
+		select {
+		case r := <-c:
+			return r.res, r.err
+		case <-ctx.Done():
+			ctx.Trace("grpc.interrupt", "Request cancelled or timed out",
+				log.Error(ctx.Err()),
+			)
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// errDraining is the error returned to RPCs received while draining
+var errDraining = status.Error(codes.Unavailable, "server is draining")
+
+// recovered logs a recovered panic and returns an Internal error
+func recovered(ctx journey.Ctx, recover interface{}) error {
+	ctx.Error("grpc.mw.panic", "Recovered from panic",
+		log.Object("err", recover),
+		log.String("stack", string(debug.Stack())),
+	)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// splitMethod splits a full method name ("/package.Service/Method") into its
+// service and method names
+func splitMethod(fullMethod string) (service, method string) {
+	s := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "unknown", s
+}
+
+// fullMethod returns the full name of the method called by the RPC
+func fullMethod(ctx journey.Ctx) string {
+	if method, ok := ctx.Load("Method").(string); ok {
+		return method
+	}
+	return ""
+}
+
+// peerAddr returns the address of the client which sent the RPC
+func peerAddr(ctx journey.Ctx) string {
+	if addr, ok := ctx.Load("Peer").(string); ok {
+		return addr
+	}
+	return "unknown"
+}
+
+// elapsed returns the time elapsed since the RPC has been received
+func elapsed(ctx journey.Ctx) time.Duration {
+	startTime := ctx.Load("Start-Time").(int64)
+	return time.Duration(time.Now().UnixNano() - startTime)
+}
+
+// msgSize returns the encoded size of a protobuf message, or 0 for anything
+// else
+func msgSize(m interface{}) int {
+	if m, ok := m.(proto.Message); ok {
+		return proto.Size(m)
+	}
+	return 0
+}
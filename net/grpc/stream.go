@@ -0,0 +1,196 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// StreamHandler handles a streaming RPC. The Context of stream returns ctx.
+type StreamHandler func(ctx journey.Ctx, stream grpc.ServerStream) error
+
+// StreamServerMiddleware is a function called on the stream RPC stack
+type StreamServerMiddleware func(next StreamHandler) StreamHandler
+
+// StreamClientMiddleware is a function called on the client stream RPC stack
+type StreamClientMiddleware func(grpc.Streamer) grpc.Streamer
+
+// ServerStream is a grpc.ServerStream whose context is a journey
+type ServerStream struct {
+	grpc.ServerStream
+
+	ctx journey.Ctx
+}
+
+// Context returns the journey of the stream
+func (s *ServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// Journey returns the journey of the stream
+func (s *ServerStream) Journey() journey.Ctx {
+	return s.ctx
+}
+
+func (s *Server) streamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	// Streams can be long-lived, so they are only bound by the client deadline
+	ctx, err := s.newJourney(ss.Context(), journey.WithoutTimeout())
+	if err != nil {
+		return err
+	}
+	defer ctx.End()
+	ctx.Store("Method", info.FullMethod)
+
+	// Build middleware chain and then call it
+	next := func(ctx journey.Ctx, stream grpc.ServerStream) error {
+		return handler(srv, stream)
+	}
+	for i := len(s.streamMiddlewares) - 1; i >= 0; i-- {
+		next = s.streamMiddlewares[i](next)
+	}
+	return next(ctx, &ServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// mwServerStreamDrain rejects streams while the server is draining
+func (s *Server) mwServerStreamDrain(next StreamHandler) StreamHandler {
+	return func(ctx journey.Ctx, stream grpc.ServerStream) error {
+		if s.isDraining() {
+			ctx.Trace("grpc.draining", "Server is draining")
+			return errDraining
+		}
+		return next(ctx, stream)
+	}
+}
+
+// mwServerStreamPanic catches panics and turns them into Internal errors
+func mwServerStreamPanic(next StreamHandler) StreamHandler {
+	return func(ctx journey.Ctx, stream grpc.ServerStream) (err error) {
+		defer func() {
+			if ctx.AppConfig().Request.Panic {
+				return
+			}
+			if recover := recover(); recover != nil {
+				err = recovered(ctx, recover)
+			}
+		}()
+		return next(ctx, stream)
+	}
+}
+
+// mwServerStreamLogging logs information about streams
+func mwServerStreamLogging(next StreamHandler) StreamHandler {
+	return func(ctx journey.Ctx, stream grpc.ServerStream) error {
+		service, method := splitMethod(fullMethod(ctx))
+		ctx.Trace("h.grpc.stream.start", "Stream start",
+			log.String("service", service),
+			log.String("method", method),
+			log.String("peer", peerAddr(ctx)),
+		)
+
+		// Next middleware
+		err := next(ctx, stream)
+
+		ctx.Trace("h.grpc.stream.end", "Stream end",
+			log.Stringer("code", status.Code(err)),
+			log.Duration("duration", elapsed(ctx)),
+			log.Error(err),
+		)
+		return err
+	}
+}
+
+// mwServerStreamStats sends the stream stats, including a stat per message
+func mwServerStreamStats(next StreamHandler) StreamHandler {
+	return func(ctx journey.Ctx, stream grpc.ServerStream) error {
+		service, method := splitMethod(fullMethod(ctx))
+		tags := map[string]string{
+			"service": service,
+			"method":  method,
+		}
+		ctx.Stats().Inc("grpc.stream.conc", tags)
+
+		// Next middleware
+		err := next(ctx, &statsStream{ServerStream: stream, ctx: ctx, tags: tags})
+
+		ctx.Stats().Dec("grpc.stream.conc", tags)
+		tags = map[string]string{
+			"service": service,
+			"method":  method,
+			"status":  status.Code(err).String(),
+		}
+		ctx.Stats().Histogram("grpc.stream.call", 1, tags)
+		ctx.Stats().Timing("grpc.stream.time", elapsed(ctx), tags)
+		return err
+	}
+}
+
+// statsStream sends a stat for each message sent or received
+type statsStream struct {
+	grpc.ServerStream
+
+	ctx  journey.Ctx
+	tags map[string]string
+}
+
+func (s *statsStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.inc("sent", m)
+	}
+	return err
+}
+
+func (s *statsStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.inc("received", m)
+	}
+	return err
+}
+
+func (s *statsStream) inc(direction string, m interface{}) {
+	tags := map[string]string{"direction": direction}
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+	s.ctx.Stats().Histogram("grpc.stream.msg", 1, tags)
+	s.ctx.Stats().Histogram("grpc.stream.msg.size", msgSize(m), tags)
+}
+
+// AppendStreamMiddleware appends a stream middleware to the client call chain
+func (c *Client) AppendStreamMiddleware(m StreamClientMiddleware) {
+	c.streamMiddlewares = append(c.streamMiddlewares, m)
+}
+
+// streamInterceptor intercepts the creation of a client stream
+func (c *Client) streamInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	if c.PropagateContext {
+		var err error
+		ctx, err = EmbedContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Build middleware chain and then call it
+	next := streamer
+	for i := len(c.streamMiddlewares) - 1; i >= 0; i-- {
+		next = c.streamMiddlewares[i](next)
+	}
+	return next(ctx, desc, cc, method, opts...)
+}
@@ -0,0 +1,166 @@
+package grpc_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/ctx/journey"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+func TestStream(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+	appCtx.Config().Request.AllowContext = true
+
+	// Build server
+	var methods []string
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Echo_serviceDesc, &echoServer{t: tt})
+	h.AppendStreamMiddleware(func(next lgrpc.StreamHandler) lgrpc.StreamHandler {
+		return func(ctx journey.Ctx, stream grpc.ServerStream) error {
+			methods = append(methods, ctx.Load("Method").(string))
+			return next(ctx, stream)
+		}
+	})
+	addr := startServer(appCtx, h)
+	defer h.Drain()
+
+	// Build client
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.PropagateContext = true
+	var streams int
+	c.AppendStreamMiddleware(func(next grpc.Streamer) grpc.Streamer {
+		return func(
+			ctx context.Context,
+			desc *grpc.StreamDesc,
+			cc *grpc.ClientConn,
+			method string,
+			opts ...grpc.CallOption,
+		) (grpc.ClientStream, error) {
+			streams++
+			return next(ctx, desc, cc, method, opts...)
+		}
+	})
+
+	ctx := journey.New(appCtx)
+	ctx.Store("lang", "en_GB")
+	stream, err := c.GRPC.NewStream(ctx, &_Echo_serviceDesc.Streams[0], "/grpc_test.Echo/Echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := stream.SendMsg(&Request{Msg: msg}); err != nil {
+			t.Fatal(err)
+		}
+		res := &Response{}
+		if err := stream.RecvMsg(res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Msg != msg+":en_GB" {
+			t.Errorf("expect %s:en_GB, but got %s", msg, res.Msg)
+		}
+	}
+	stream.CloseSend()
+	if err := stream.RecvMsg(&Response{}); err != io.EOF {
+		t.Errorf("expect stream to end, but got %v", err)
+	}
+
+	if streams != 1 {
+		t.Errorf("expect client middleware to be called once, but got %d", streams)
+	}
+	if len(methods) != 1 || methods[0] != "/grpc_test.Echo/Echo" {
+		t.Errorf("expect server middleware to be called with the method, but got %v", methods)
+	}
+}
+
+// TestStreamTimeout tests whether streams outlive the request timeout
+func TestStreamTimeout(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-grpc")
+	appCtx.Config().Request.AllowContext = true
+	appCtx.Config().Request.TimeoutMS = 10
+
+	h := lgrpc.NewServer()
+	h.RegisterService(&_Echo_serviceDesc, &echoServer{t: tt})
+	addr := startServer(appCtx, h)
+	defer h.Drain()
+
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.PropagateContext = true
+
+	ctx := journey.New(appCtx, journey.WithoutTimeout())
+	stream, err := c.GRPC.NewStream(ctx, &_Echo_serviceDesc.Streams[0], "/grpc_test.Echo/Echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"a", "b"} {
+		if err := stream.SendMsg(&Request{Msg: msg}); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.RecvMsg(&Response{}); err != nil {
+			t.Fatal("expect stream to be alive", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	stream.CloseSend()
+}
+
+// echoServer replies to each message with the message and the journey lang
+type echoServer struct {
+	t *lt.T
+}
+
+func (s *echoServer) echo(stream grpc.ServerStream) error {
+	ctx, ok := stream.Context().(journey.Ctx)
+	if !ok {
+		s.t.Error("expect stream context to be a journey")
+		return nil
+	}
+	lang, _ := ctx.Load("lang").(string)
+
+	for {
+		req := &Request{}
+		err := stream.RecvMsg(req)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if err := stream.SendMsg(&Response{Msg: req.Msg + ":" + lang}); err != nil {
+			return err
+		}
+	}
+}
+
+var _Echo_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "grpc_test.Echo",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Echo",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(*echoServer).echo(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
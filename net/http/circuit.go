@@ -0,0 +1,90 @@
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/stairlin/lego/circuit"
+	"github.com/stairlin/lego/ctx/journey"
+)
+
+// ClientCircuitBreaker returns a client middleware which sends requests
+// through the breaker with the given name (see journey.Ctx.Do). Connection
+// errors and 5xx responses count as failures, and requests fail fast with
+// circuit.ErrOpen while the circuit is open.
+//
+// The breaker timeout covers the whole response, so the response body is read
+// before it is returned. Use ClientBodyLimit to bound its size.
+func ClientCircuitBreaker(name string) ClientMiddleware {
+	return func(next ClientFunc) ClientFunc {
+		return func(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
+			// The call keeps running when the breaker times out, so the
+			// response is only handed over once it has returned
+			resc := make(chan *http.Response, 1)
+			err := ctx.Do(name, func(ctx journey.Ctx) error {
+				res, err := next(ctx, req)
+				if err != nil {
+					return err
+				}
+				body, err := ioutil.ReadAll(res.Body)
+				res.Body.Close()
+				if err != nil {
+					return err
+				}
+				res.Body = ioutil.NopCloser(bytes.NewReader(body))
+				if res.StatusCode >= StatusInternalServerError {
+					return &serverError{res: res}
+				}
+				resc <- res
+				return nil
+			}, nil)
+			switch err := err.(type) {
+			case nil:
+				return <-resc, nil
+			case *serverError:
+				return err.res, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// serverError reports a 5xx response to the breaker
+type serverError struct {
+	res *http.Response
+}
+
+func (e *serverError) Error() string {
+	return "http: " + e.res.Status
+}
+
+// CircuitBreaker returns a round tripper which sends requests through the
+// given breaker. Connection errors and 5xx responses count as failures, and
+// requests fail fast with circuit.ErrOpen while the circuit is open.
+//
+// The breaker timeout is not applied, since the response body is read after
+// the request returns. Use ClientCircuitBreaker instead, or http.Client.Timeout.
+//
+// When next is nil, http.DefaultTransport is used.
+func CircuitBreaker(b *circuit.Breaker, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &breakerTransport{b: b, next: next}
+}
+
+type breakerTransport struct {
+	b    *circuit.Breaker
+	next http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.b.Allow()
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.next.RoundTrip(req)
+	done(err == nil && res.StatusCode < StatusInternalServerError)
+	return res, err
+}
@@ -1,17 +1,33 @@
 package http
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/ctx/app"
 	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/log"
+	"github.com/stairlin/lego/net/balancer"
+	"github.com/stairlin/lego/net/naming"
+	"github.com/stairlin/lego/net/retry"
 )
 
 // DefaultClient is the default Client and is used by Get, Head, and Post.
 var DefaultClient = &Client{}
 
+// DefaultMaxRetries is the number of times an idempotent request is retried on
+// another instance after a connection failure
+const DefaultMaxRetries = 2
+
 // Client is a wrapper for the standard net/http client.
 type Client struct {
 	// HTTP is the standard net/http client
@@ -22,6 +38,43 @@ type Client struct {
 	// or another LEGO-compatible service. The context can potentially leak
 	// sensitive information, so do not activate it for services that you don't trust.
 	PropagateContext bool
+	// Balancer picks the address to which requests are sent (optional)
+	//
+	// When it is set, the request URL host is replaced by the picked address,
+	// and the original host is kept in the Host header.
+	Balancer *balancer.Balancer
+	// Resolver resolves URLs with a naming scheme, such as disco://service/path
+	// or dns://host:port/path (optional)
+	//
+	// Each target gets its own balancer, which keeps a live address set from
+	// the resolver watcher.
+	Resolver naming.Resolver
+	// Policy creates the balancing policy of resolved targets (default: RoundRobin)
+	Policy func() balancer.Policy
+	// Scheme is the scheme of requests sent to resolved targets (default: http)
+	Scheme string
+	// MaxRetries is the number of times an idempotent request is retried on
+	// another instance after a connection failure. When it is zero,
+	// DefaultMaxRetries is used, and a negative value disables retries.
+	MaxRetries int
+	// Retry is the retry policy of idempotent requests (optional)
+	//
+	// Requests are retried after a transport error or a retryable status
+	// code (by default 429, 502, 503 and 504). The Retry-After header is
+	// respected. The policy can be overridden per request with
+	// retry.WithPolicy on the request context.
+	Retry *retry.Policy
+
+	middlewares []ClientMiddleware
+
+	mu        sync.Mutex
+	balancers map[string]*balancer.Balancer
+}
+
+// NewClient returns a client which resolves URLs with a naming scheme, such as
+// disco://service/path, through the naming package
+func NewClient(ctx app.Ctx) *Client {
+	return &Client{Resolver: naming.URI(ctx)}
 }
 
 // Do sends an HTTP request with the provided http.Client and returns
@@ -32,14 +85,95 @@ type Client struct {
 // The provided ctx must be non-nil. If it is canceled or times out,
 // ctx.Err() will be returned.
 func (c *Client) Do(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
-	if c.PropagateContext {
-		if err := MarshalContext(ctx, req); err != nil {
+	b, resolved, err := c.balancer(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	p := retry.FromContext(req.Context(), c.Retry)
+	idempotent := isIdempotent(req)
+	failovers := c.MaxRetries
+	if failovers == 0 {
+		failovers = DefaultMaxRetries
+	}
+
+	tried := map[string]struct{}{}
+	for attempt, sent, failedOver := 1, 0, 0; ; attempt, sent = attempt+1, sent+1 {
+		r, addr := req, ""
+		var done func()
+		if b != nil {
+			r, addr, done, err = c.pick(ctx, b, req, resolved, tried)
+			if err != nil {
+				return nil, err
+			}
+			tried[addr] = struct{}{}
+		}
+		if sent > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				if done != nil {
+					done()
+				}
+				return nil, err
+			}
+			rc := *r
+			rc.Body = body
+			r = &rc
+		}
+
+		res, err := c.do(ctx, r, done)
+
+		// Fail over to another instance right away when the connection failed,
+		// until all instances have been tried. It does not count as an attempt
+		// of the retry policy.
+		if err != nil && b != nil && idempotent && isConnError(err) &&
+			failedOver < failovers && len(tried) < len(b.Addrs()) {
+			c.retried(ctx, req, "failover", addr, err)
+			failedOver++
+			attempt--
+			continue
+		}
+
+		d, ok := retryDelay(ctx, p, attempt, idempotent, res, err)
+		if !ok {
+			if p != nil && err == nil && !p.Retryable(res.StatusCode, retryableStatus...) {
+				p.Success()
+			}
+			return res, err
+		}
+		if err == nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+			c.retried(ctx, req, strconv.Itoa(res.StatusCode), addr, nil)
+		} else {
+			c.retried(ctx, req, "error", addr, err)
+		}
+		if err := retry.Sleep(ctx, d); err != nil {
 			return nil, err
 		}
 	}
+}
+
+// Close releases the balancers of resolved targets
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for target, b := range c.balancers {
+		b.Close()
+		delete(c.balancers, target)
+	}
+	return nil
+}
 
-	resp, err := c.HTTP.Do(req.WithContext(ctx))
+func (c *Client) do(
+	ctx journey.Ctx, req *http.Request, done func(),
+) (*http.Response, error) {
+	resp, err := c.buildMiddlewareChain()(ctx, req)
 	if err != nil {
+		if done != nil {
+			done()
+		}
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
@@ -47,9 +181,207 @@ func (c *Client) Do(ctx journey.Ctx, req *http.Request) (*http.Response, error)
 			return nil, err
 		}
 	}
+	if done != nil {
+		// The request is in flight until its body has been closed
+		resp.Body = &doneBody{ReadCloser: resp.Body, done: done}
+	}
 	return resp, nil
 }
 
+// balancer returns the balancer of the given URL, or nil when the request
+// should be sent as is. resolved tells whether the URL has a naming scheme.
+func (c *Client) balancer(u *url.URL) (b *balancer.Balancer, resolved bool, err error) {
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return c.Balancer, false, nil
+	}
+	if c.Resolver == nil {
+		return nil, false, errors.Errorf("http: no resolver for %s URLs", u.Scheme)
+	}
+
+	target := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.balancers[target]; ok {
+		if b.Err() == nil {
+			return b, true, nil
+		}
+		// The target is no longer watched, so it is resolved again
+		b.Close()
+		delete(c.balancers, target)
+	}
+
+	w, err := c.Resolver.Resolve(target)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "http: cannot resolve %s", target)
+	}
+	p := balancer.RoundRobin
+	if c.Policy != nil {
+		p = c.Policy
+	}
+	b = balancer.New(w, p())
+	if c.balancers == nil {
+		c.balancers = map[string]*balancer.Balancer{}
+	}
+	c.balancers[target] = b
+	return b, true, nil
+}
+
+// pick returns a copy of req sent to an address picked by the balancer. An
+// address which has already been tried is skipped, unless there is no other
+// one. The consistent hashing key can be set on the request context.
+func (c *Client) pick(
+	ctx journey.Ctx,
+	b *balancer.Balancer,
+	req *http.Request,
+	resolved bool,
+	tried map[string]struct{},
+) (*http.Request, string, func(), error) {
+	var pctx context.Context = ctx
+	if key, ok := balancer.HashKey(req.Context()); ok {
+		pctx = balancer.WithHashKey(ctx, key)
+	}
+
+	var addr string
+	var done func()
+	for i := 0; ; i++ {
+		var err error
+		addr, done, err = b.Pick(pctx)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if _, ok := tried[addr]; !ok || i >= len(b.Addrs()) {
+			break
+		}
+		done()
+	}
+
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Host = addr
+	if resolved {
+		u.Scheme = c.Scheme
+		if u.Scheme == "" {
+			u.Scheme = "http"
+		}
+	}
+	r.URL = &u
+	if r.Host == "" {
+		r.Host = req.URL.Host
+	}
+	return r, addr, done, nil
+}
+
+// retried logs and counts a retry
+func (c *Client) retried(
+	ctx journey.Ctx, req *http.Request, reason, addr string, err error,
+) {
+	ctx.Trace("http.client.retry", "Retry request",
+		log.String("host", req.URL.Host),
+		log.String("addr", addr),
+		log.String("reason", reason),
+		log.Error(err),
+	)
+	ctx.Stats().Inc("http.client.retry", map[string]string{
+		"host":   req.URL.Host,
+		"reason": reason,
+	})
+}
+
+// retryableStatus contains the status codes retried by default
+var retryableStatus = []int{
+	StatusTooManyRequests,
+	StatusBadGateway,
+	StatusServiceUnavailable,
+	StatusGatewayTimeout,
+}
+
+// retryDelay returns the delay before retrying a request, and whether it
+// can be retried at all
+func retryDelay(
+	ctx journey.Ctx,
+	p *retry.Policy,
+	attempt int,
+	idempotent bool,
+	res *http.Response,
+	err error,
+) (time.Duration, bool) {
+	if p == nil || !idempotent || attempt >= p.Attempts() {
+		return 0, false
+	}
+
+	d := p.Backoff(attempt)
+	switch {
+	case err != nil:
+		if ctx.Err() != nil {
+			return 0, false
+		}
+	case p.Retryable(res.StatusCode, retryableStatus...):
+		if after, ok := retryAfter(res); ok {
+			d = after
+		}
+	default:
+		return 0, false
+	}
+	return d, p.Allow(ctx, d)
+}
+
+// retryAfter parses the Retry-After header, which contains either a number
+// of seconds or a date
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// isIdempotent tells whether req can safely be sent again. Requests with
+// an Idempotency-Key header are considered idempotent.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", GET, HEAD, OPTIONS, PUT, DELETE:
+	default:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// isConnError tells whether err occurred while connecting to the upstream
+// endpoint, which means the request has not been sent
+func isConnError(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	e, ok := err.(*net.OpError)
+	return ok && e.Op == "dial"
+}
+
+// doneBody calls done once the body is closed
+type doneBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *doneBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
 // Get issues a GET request via the Do function.
 func (c *Client) Get(ctx journey.Ctx, url string) (*http.Response, error) {
 	req, err := http.NewRequest(GET, url, nil)
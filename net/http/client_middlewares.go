@@ -0,0 +1,190 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/log"
+)
+
+var (
+	// ErrRequestTooLarge is the error returned when a request body is larger
+	// than the limit set by ClientBodyLimit
+	ErrRequestTooLarge = errors.New("http: request body too large")
+	// ErrResponseTooLarge is the error returned when a response body is larger
+	// than the limit set by ClientBodyLimit
+	ErrResponseTooLarge = errors.New("http: response body too large")
+)
+
+// ClientFunc sends a request and returns its response
+type ClientFunc func(ctx journey.Ctx, req *http.Request) (*http.Response, error)
+
+// ClientMiddleware is a function called on the HTTP client stack before a
+// request is sent.
+//
+// Middlewares are called for every attempt, so a request which is retried
+// goes through them several times.
+type ClientMiddleware func(next ClientFunc) ClientFunc
+
+// AppendMiddleware appends a middleware to the client call chain
+func (c *Client) AppendMiddleware(m ClientMiddleware) {
+	c.middlewares = append(c.middlewares, m)
+}
+
+func (c *Client) buildMiddlewareChain() ClientFunc {
+	f := func(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
+		return c.HTTP.Do(req.WithContext(ctx))
+	}
+
+	l := []ClientMiddleware{mwClientLogging, mwClientStats}
+	if c.PropagateContext {
+		l = append(l, mwClientContext)
+	}
+	l = append(l, c.middlewares...)
+	for i := len(l) - 1; i >= 0; i-- {
+		f = l[i](f)
+	}
+	return f
+}
+
+// ClientAuth returns a middleware which sets the Authorization header of
+// requests to the value returned by f (e.g. "Bearer <token>")
+func ClientAuth(f func(ctx journey.Ctx) (string, error)) ClientMiddleware {
+	return func(next ClientFunc) ClientFunc {
+		return func(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
+			v, err := f(ctx)
+			if err != nil {
+				return nil, errors.Wrap(err, "http: cannot get authorization")
+			}
+			req.Header.Set("Authorization", v)
+			return next(ctx, req)
+		}
+	}
+}
+
+// ClientBodyLimit returns a middleware which limits the size of request and
+// response bodies. Reading a body beyond its limit fails with
+// ErrRequestTooLarge or ErrResponseTooLarge. A limit of zero or less
+// disables it.
+func ClientBodyLimit(maxReq, maxRes int64) ClientMiddleware {
+	return func(next ClientFunc) ClientFunc {
+		return func(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
+			if maxReq > 0 && req.Body != nil && req.Body != http.NoBody {
+				if req.ContentLength > maxReq {
+					return nil, ErrRequestTooLarge
+				}
+				r := *req
+				r.Body = &limitedBody{
+					ReadCloser: req.Body, n: maxReq, err: ErrRequestTooLarge,
+				}
+				req = &r
+			}
+
+			res, err := next(ctx, req)
+			if err != nil || maxRes <= 0 {
+				return res, err
+			}
+			if res.ContentLength > maxRes {
+				res.Body.Close()
+				return nil, ErrResponseTooLarge
+			}
+			res.Body = &limitedBody{
+				ReadCloser: res.Body, n: maxRes, err: ErrResponseTooLarge,
+			}
+			return res, nil
+		}
+	}
+}
+
+// limitedBody fails with err once more than n bytes have been read
+type limitedBody struct {
+	io.ReadCloser
+	n   int64
+	err error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, b.err
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return n, b.err
+	}
+	return n, err
+}
+
+// mwClientLogging logs information about outbound requests/responses
+func mwClientLogging(next ClientFunc) ClientFunc {
+	return func(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
+		ctx.Trace("c.http.req.start", "Request start",
+			log.String("method", req.Method),
+			log.String("host", host(req)),
+			log.String("addr", req.URL.Host),
+			log.String("path", req.URL.Path),
+		)
+		start := time.Now()
+
+		res, err := next(ctx, req)
+
+		fields := []log.Field{log.Duration("duration", time.Since(start))}
+		if err != nil {
+			fields = append(fields, log.Error(err))
+		} else {
+			fields = append(fields, log.Int("status", res.StatusCode))
+		}
+		ctx.Trace("c.http.req.end", "Request end", fields...)
+		return res, err
+	}
+}
+
+// mwClientStats sends the outbound request/response stats
+func mwClientStats(next ClientFunc) ClientFunc {
+	return func(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
+		tags := map[string]string{
+			"method": req.Method,
+			"host":   host(req),
+		}
+		ctx.Stats().Inc("http.client.conc", tags)
+		start := time.Now()
+
+		res, err := next(ctx, req)
+
+		ctx.Stats().Dec("http.client.conc", tags)
+		if err != nil {
+			tags["status"] = "error"
+		} else {
+			tags["status"] = strconv.Itoa(res.StatusCode)
+		}
+		ctx.Stats().Histogram("http.client.call", 1, tags)
+		ctx.Stats().Timing("http.client.time", time.Since(start), tags)
+		return res, err
+	}
+}
+
+// mwClientContext propagates the journey upstream
+func mwClientContext(next ClientFunc) ClientFunc {
+	return func(ctx journey.Ctx, req *http.Request) (*http.Response, error) {
+		if err := MarshalContext(ctx, req); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// host returns the host to which req is sent. It is the original host when
+// the request has been sent to an address picked by a balancer.
+func host(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
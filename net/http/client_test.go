@@ -0,0 +1,486 @@
+package http_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	netHttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/circuit"
+	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/disco"
+	"github.com/stairlin/lego/net/balancer"
+	"github.com/stairlin/lego/net/http"
+	"github.com/stairlin/lego/net/naming"
+	"github.com/stairlin/lego/net/retry"
+	lt "github.com/stairlin/lego/testing"
+)
+
+func TestClientWithBalancer(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	var mu sync.Mutex
+	var hosts []string
+	var updates []*naming.Update
+	for i := 0; i < 2; i++ {
+		s := httptest.NewServer(netHttp.HandlerFunc(
+			func(w netHttp.ResponseWriter, r *netHttp.Request) {
+				mu.Lock()
+				hosts = append(hosts, r.Host)
+				mu.Unlock()
+				w.Write([]byte(r.URL.Path))
+			},
+		))
+		defer s.Close()
+		updates = append(updates, &naming.Update{
+			Op:   naming.Add,
+			Addr: strings.TrimPrefix(s.URL, "http://"),
+		})
+	}
+	w := &staticWatcher{c: make(chan []*naming.Update, 1)}
+	w.c <- updates
+
+	c := &http.Client{Balancer: balancer.New(w, balancer.LeastOutstanding())}
+	defer c.Balancer.Close()
+
+	for i := 0; i < 4; i++ {
+		res, err := c.Get(journey.New(appCtx), "http://api.http/ping")
+		if err != nil {
+			t.Fatal("expect request to succeed", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "/ping" {
+			t.Errorf("expect path to be kept, but got %s", body)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hosts) != 4 {
+		t.Fatalf("expect 4 requests, but got %d", len(hosts))
+	}
+	for _, h := range hosts {
+		if h != "api.http" {
+			t.Errorf("expect Host header to be api.http, but got %s", h)
+		}
+	}
+}
+
+func TestClientWithDeadInstance(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	w := &staticWatcher{c: make(chan []*naming.Update, 1)}
+	w.c <- []*naming.Update{{Op: naming.Add, Addr: addr}}
+	c := &http.Client{Balancer: balancer.New(w, balancer.LeastOutstanding())}
+	defer c.Balancer.Close()
+
+	var dials int32
+	dialer := &net.Dialer{}
+	c.HTTP.Transport = &netHttp.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Get(journey.New(appCtx), "http://api.http/ping")
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("expect request to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect request to give up")
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Errorf("expect the dead instance to be dialled once, but got %d", n)
+	}
+}
+
+func TestClientWithDiscoURL(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	s := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			upstream, err := http.UnmarshalContext(appCtx, r)
+			if err != nil || upstream.UUID() != r.Header.Get("Journey-ID") {
+				w.WriteHeader(netHttp.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(r.Host + r.URL.Path))
+		},
+	))
+	defer s.Close()
+
+	// Register a live instance and an instance which refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	for _, addr := range []string{strings.TrimPrefix(s.URL, "http://"), l.Addr().String()} {
+		host, port, _ := net.SplitHostPort(addr)
+		p, _ := strconv.Atoi(port)
+		_, err := appCtx.Disco().Register(appCtx, &disco.Registration{
+			Name: "api.http",
+			Addr: host,
+			Port: uint16(p),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := http.NewClient(appCtx)
+	c.PropagateContext = true
+	defer c.Close()
+
+	for i := 0; i < 4; i++ {
+		ctx := journey.New(appCtx)
+		req, _ := netHttp.NewRequest(http.GET, "disco://api.http/ping", nil)
+		req.Header.Set("Journey-ID", ctx.UUID())
+		res, err := c.Do(ctx, req)
+		if err != nil {
+			t.Fatal("expect request to be retried on the live instance", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expect journey to be propagated, but got %d", res.StatusCode)
+		}
+		if string(body) != "api.http/ping" {
+			t.Errorf("expect api.http/ping, but got %s", body)
+		}
+	}
+
+	// Round-robin alternates between both instances, so one of two
+	// non-idempotent requests hits the unreachable instance
+	var failures int
+	for i := 0; i < 2; i++ {
+		res, err := c.Post(
+			journey.New(appCtx), "disco://api.http/ping", "text/plain", nil,
+		)
+		if err != nil {
+			failures++
+			continue
+		}
+		res.Body.Close()
+	}
+	if failures != 1 {
+		t.Errorf("expect POST requests not to be retried, but got %d failures", failures)
+	}
+}
+
+// TestClientResolvesAgain tests whether a target is resolved again once its
+// watcher has stopped
+func TestClientResolvesAgain(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	s := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			w.Write([]byte(r.URL.Path))
+		},
+	))
+	defer s.Close()
+
+	r := &flakyResolver{addr: strings.TrimPrefix(s.URL, "http://")}
+	c := &http.Client{Resolver: r}
+	defer c.Close()
+
+	if _, err := c.Get(journey.New(appCtx), "test://api.http/ping"); err == nil {
+		t.Fatal("expect request to fail when the target is not watched")
+	}
+	res, err := c.Get(journey.New(appCtx), "test://api.http/ping")
+	if err != nil {
+		t.Fatal("expect request to succeed once the target is resolved again", err)
+	}
+	res.Body.Close()
+	if r.resolved != 2 {
+		t.Errorf("expect target to be resolved twice, but got %d", r.resolved)
+	}
+}
+
+// flakyResolver is a resolver whose first watcher is closed
+type flakyResolver struct {
+	addr     string
+	resolved int
+}
+
+func (r *flakyResolver) Resolve(target string) (naming.Watcher, error) {
+	r.resolved++
+	if r.resolved == 1 {
+		return &closedWatcher{}, nil
+	}
+	w := &staticWatcher{c: make(chan []*naming.Update, 1)}
+	w.c <- []*naming.Update{{Op: naming.Add, Addr: r.addr}}
+	return w, nil
+}
+
+type closedWatcher struct{}
+
+func (w *closedWatcher) Next() ([]*naming.Update, error) {
+	return nil, naming.ErrWatcherClosed
+}
+
+func (w *closedWatcher) Close() error {
+	return nil
+}
+
+type staticWatcher struct {
+	c chan []*naming.Update
+}
+
+func (w *staticWatcher) Next() ([]*naming.Update, error) {
+	l, ok := <-w.c
+	if !ok {
+		return nil, naming.ErrWatcherClosed
+	}
+	return l, nil
+}
+
+func (w *staticWatcher) Close() error {
+	close(w.c)
+	return nil
+}
+
+func TestClientWithCircuitBreaker(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	s := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			w.WriteHeader(netHttp.StatusServiceUnavailable)
+		},
+	))
+	defer s.Close()
+
+	appCtx.Circuit().Configure("api", circuit.WithVolumeThreshold(2))
+	c := &http.Client{}
+	c.HTTP.Transport = http.CircuitBreaker(appCtx.Circuit().Get("api"), nil)
+
+	for i := 0; i < 2; i++ {
+		res, err := c.Get(journey.New(appCtx), s.URL)
+		if err != nil {
+			t.Fatal("expect request to reach the server", err)
+		}
+		res.Body.Close()
+	}
+	_, err := c.Get(journey.New(appCtx), s.URL)
+	if err == nil || !strings.Contains(err.Error(), circuit.ErrOpen.Error()) {
+		t.Errorf("expect circuit to be open, but got %v", err)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	var mu sync.Mutex
+	status := netHttp.StatusOK
+	s := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			if r.URL.Path == "/slow" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			mu.Lock()
+			w.WriteHeader(status)
+			mu.Unlock()
+			w.Write([]byte("body"))
+		},
+	))
+	defer s.Close()
+
+	appCtx.Circuit().Configure("api",
+		circuit.WithVolumeThreshold(3),
+		circuit.WithTimeout(10*time.Millisecond),
+	)
+	c := &http.Client{}
+	c.AppendMiddleware(http.ClientCircuitBreaker("api"))
+
+	// The body is still readable once the breaker call has returned
+	res, err := c.Get(journey.New(appCtx), s.URL)
+	if err != nil {
+		t.Fatal("expect request to succeed", err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || string(body) != "body" {
+		t.Errorf("expect body to be readable, but got %q (%v)", body, err)
+	}
+
+	// The breaker timeout is applied
+	_, err = c.Get(journey.New(appCtx), s.URL+"/slow")
+	if err != circuit.ErrTimeout {
+		t.Errorf("expect request to time out, but got %v", err)
+	}
+
+	// 5xx responses are returned, and open the circuit
+	mu.Lock()
+	status = netHttp.StatusServiceUnavailable
+	mu.Unlock()
+	res, err = c.Get(journey.New(appCtx), s.URL)
+	if err != nil {
+		t.Fatal("expect request to reach the server", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != netHttp.StatusServiceUnavailable {
+		t.Errorf("expect status 503, but got %d", res.StatusCode)
+	}
+	_, err = c.Get(journey.New(appCtx), s.URL)
+	if err != circuit.ErrOpen {
+		t.Errorf("expect circuit to be open, but got %v", err)
+	}
+}
+
+func TestClientCircuitBreakerTimeout(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+	appCtx.Circuit().Configure("api", circuit.WithTimeout(time.Millisecond))
+
+	// The call ignores its context, so it returns after the breaker timeout
+	returned := make(chan struct{})
+	f := http.ClientCircuitBreaker("api")(func(
+		ctx journey.Ctx, req *netHttp.Request,
+	) (*netHttp.Response, error) {
+		defer close(returned)
+		time.Sleep(20 * time.Millisecond)
+		return &netHttp.Response{
+			StatusCode: netHttp.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("body")),
+		}, nil
+	})
+
+	req, _ := netHttp.NewRequest("GET", "http://127.0.0.1", nil)
+	res, err := f(journey.New(appCtx), req)
+	if err != circuit.ErrTimeout || res != nil {
+		t.Errorf("expect request to time out without response, but got %v (%v)", res, err)
+	}
+	<-returned
+}
+
+func TestClientWithRetryPolicy(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	s := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			mu.Lock()
+			calls[r.Method]++
+			n := calls[r.Method]
+			mu.Unlock()
+			if n < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(netHttp.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(netHttp.StatusOK)
+		},
+	))
+	defer s.Close()
+
+	c := &http.Client{Retry: &retry.Policy{MaxAttempts: 3, MinBackoff: time.Millisecond}}
+	res, err := c.Get(journey.New(appCtx), s.URL)
+	if err != nil {
+		t.Fatal("expect request to succeed", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expect request to succeed on the third attempt, but got %d", res.StatusCode)
+	}
+
+	res, err = c.Post(journey.New(appCtx), s.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal("expect request to reach the server", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expect POST request not to be retried, but got %d", res.StatusCode)
+	}
+
+	// Retries can be disabled per request
+	req, _ := netHttp.NewRequest(http.DELETE, s.URL, nil)
+	req = req.WithContext(retry.WithPolicy(req.Context(), nil))
+	res, err = c.Do(journey.New(appCtx), req)
+	if err != nil {
+		t.Fatal("expect request to reach the server", err)
+	}
+	res.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls[http.GET] != 3 || calls[http.POST] != 1 || calls[http.DELETE] != 1 {
+		t.Errorf("expect 3 GET, 1 POST and 1 DELETE, but got %v", calls)
+	}
+}
+
+func TestClientMiddlewares(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+
+	s := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			w.Write([]byte(r.Header.Get("Authorization")))
+		},
+	))
+	defer s.Close()
+
+	var order []string
+	c := &http.Client{}
+	c.AppendMiddleware(func(next http.ClientFunc) http.ClientFunc {
+		return func(ctx journey.Ctx, req *netHttp.Request) (*netHttp.Response, error) {
+			order = append(order, "first")
+			return next(ctx, req)
+		}
+	})
+	c.AppendMiddleware(http.ClientAuth(func(ctx journey.Ctx) (string, error) {
+		order = append(order, "auth")
+		return "Bearer abc", nil
+	}))
+
+	res, err := c.Get(journey.New(appCtx), s.URL)
+	if err != nil {
+		t.Fatal("expect request to succeed", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "Bearer abc" {
+		t.Errorf("expect Authorization header to be set, but got %s", body)
+	}
+	if strings.Join(order, ",") != "first,auth" {
+		t.Errorf("expect middlewares to be called in order, but got %v", order)
+	}
+
+	c.AppendMiddleware(http.ClientBodyLimit(4, 4))
+	_, err = c.Post(journey.New(appCtx), s.URL, "text/plain", strings.NewReader("hello"))
+	if err == nil || !strings.Contains(err.Error(), http.ErrRequestTooLarge.Error()) {
+		t.Errorf("expect ErrRequestTooLarge, but got %v", err)
+	}
+	_, err = c.Get(journey.New(appCtx), s.URL)
+	if err != http.ErrResponseTooLarge {
+		t.Errorf("expect ErrResponseTooLarge, but got %v", err)
+	}
+}
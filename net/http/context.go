@@ -38,6 +38,6 @@ func MarshalContext(ctx journey.Ctx, req *http.Request) error {
 		return errors.Wrap(err, "failed to marshal Context")
 	}
 	text := base64.StdEncoding.EncodeToString(data)
-	req.Header.Add(contextHeader, text)
+	req.Header.Set(contextHeader, text)
 	return nil
 }
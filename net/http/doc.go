@@ -9,4 +9,5 @@
 //  - Logging
 //  - Stats
 //  - Tracing
+//  - JSON gateway for gRPC services
 package http
@@ -0,0 +1,342 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/log"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HandleGRPC exposes the unary methods of the services registered on g with
+// RegisterService as JSON endpoints. Services must be registered on g before
+// calling it.
+//
+// A method is routed according to its google.api.http annotations, or to
+// POST /<package.Service>/<Method> when it has none. Path and query
+// parameters are set as strings on the request message, which suits string,
+// number and enum fields.
+//
+// Requests are invoked in-process with g.Invoke, so the journey of the HTTP
+// request goes through the gRPC middlewares down to the service.
+//
+// Services registered with g.Handle are not exposed, because they are only
+// known to the underlying gRPC server once g is served.
+func (s *Server) HandleGRPC(g *lgrpc.Server) {
+	for name, info := range g.ServiceInfo() {
+		rules := httpRules(name, info.Metadata)
+		for _, m := range info.Methods {
+			if m.IsClientStream || m.IsServerStream {
+				continue
+			}
+			fullMethod := "/" + name + "/" + m.Name
+			l, ok := rules[m.Name]
+			if !ok {
+				l = []*annotations.HttpRule{{
+					Pattern: &annotations.HttpRule_Post{Post: fullMethod},
+					Body:    "*",
+				}}
+			}
+			for _, rule := range l {
+				method, path := httpPattern(rule)
+				if path == "" {
+					continue
+				}
+				s.HandleEndpoint(&gatewayEndpoint{
+					method:     method,
+					path:       path,
+					fullMethod: fullMethod,
+					body:       rule.Body,
+					grpc:       g,
+				})
+			}
+		}
+	}
+}
+
+// gatewayEndpoint transcodes JSON requests to an unary gRPC method
+type gatewayEndpoint struct {
+	method     string
+	path       string
+	fullMethod string
+	body       string
+	grpc       *lgrpc.Server
+}
+
+func (e *gatewayEndpoint) Path() string {
+	return e.path
+}
+
+func (e *gatewayEndpoint) Method() string {
+	return e.method
+}
+
+func (e *gatewayEndpoint) Attach(r *mux.Router, f func(http.ResponseWriter,
+	*http.Request)) {
+	r.HandleFunc(muxPath(e.path), f).Methods(e.method, OPTIONS)
+}
+
+func (e *gatewayEndpoint) Serve(ctx journey.Ctx, w ResponseWriter, r *Request) {
+	res, err := e.grpc.Invoke(ctx, e.fullMethod, func(v interface{}) error {
+		return e.decode(r, v)
+	})
+	// The response is marshalled before writing the header, so that a
+	// missing or invalid message can still be reported as an error
+	var buf bytes.Buffer
+	if err == nil {
+		err = e.encode(&buf, res)
+	}
+	if err != nil {
+		st := status.Convert(err)
+		ctx.Trace("http.gateway.err", "RPC failed",
+			log.String("method", e.fullMethod),
+			log.Stringer("code", st.Code()),
+		)
+		(&RenderJSON{
+			Code: httpStatus(st.Code()),
+			V: struct {
+				Code    codes.Code `json:"code"`
+				Message string     `json:"message"`
+			}{Code: st.Code(), Message: st.Message()},
+		}).Render(w)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// encode writes the response message v to buf as JSON
+func (e *gatewayEndpoint) encode(buf *bytes.Buffer, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok || m == nil {
+		return status.Errorf(codes.Internal, "%T is not a protobuf message", v)
+	}
+	if err := (&jsonpb.Marshaler{OrigName: true}).Marshal(buf, m); err != nil {
+		return status.Errorf(codes.Internal, "cannot marshal response: %v", err)
+	}
+	return nil
+}
+
+// decode sets the fields of the request message v from the body, the path
+// parameters and the query string of r
+func (e *gatewayEndpoint) decode(r *Request, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "%T is not a protobuf message", v)
+	}
+
+	fields := map[string]interface{}{}
+	if e.body != "" && r.HTTP.Body != nil {
+		b, err := ioutil.ReadAll(r.HTTP.Body)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "cannot read body: %s", err)
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			var err error
+			if e.body == "*" {
+				err = unmarshalJSON(b, &fields)
+			} else {
+				var body interface{}
+				err = unmarshalJSON(b, &body)
+				setField(fields, e.body, body)
+			}
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid body: %s", err)
+			}
+		}
+	}
+	if e.body != "*" {
+		for k, l := range r.HTTP.URL.Query() {
+			if len(l) == 1 {
+				setField(fields, k, l[0])
+				continue
+			}
+			values := make([]interface{}, len(l))
+			for i := range l {
+				values[i] = l[i]
+			}
+			setField(fields, k, values)
+		}
+	}
+	for k, v := range r.Params {
+		setField(fields, k, v)
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request: %s", err)
+	}
+	if err := jsonpb.Unmarshal(bytes.NewReader(b), m); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request: %s", err)
+	}
+	return nil
+}
+
+// unmarshalJSON decodes b into v. Numbers are kept as they are written, so
+// that 64-bit integers do not lose precision.
+func unmarshalJSON(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if d.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// setField sets the value of a field path (e.g. "user.name") on fields
+func setField(fields map[string]interface{}, path string, v interface{}) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := fields[k].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			fields[k] = next
+		}
+		fields = next
+	}
+	fields[keys[len(keys)-1]] = v
+}
+
+// httpRules returns the google.api.http annotations of the methods of a
+// service, keyed by method name. metadata is the proto file of the service.
+func httpRules(
+	service string, metadata interface{},
+) map[string][]*annotations.HttpRule {
+	rules := map[string][]*annotations.HttpRule{}
+	file, ok := metadata.(string)
+	if !ok {
+		return rules
+	}
+	gz := proto.FileDescriptor(file)
+	if gz == nil {
+		return rules
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return rules
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return rules
+	}
+	fd := &descriptor.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fd); err != nil {
+		return rules
+	}
+
+	prefix := ""
+	if fd.GetPackage() != "" {
+		prefix = fd.GetPackage() + "."
+	}
+	for _, sd := range fd.Service {
+		if prefix+sd.GetName() != service {
+			continue
+		}
+		for _, md := range sd.Method {
+			if md.Options == nil || !proto.HasExtension(md.Options, annotations.E_Http) {
+				continue
+			}
+			ext, err := proto.GetExtension(md.Options, annotations.E_Http)
+			if err != nil {
+				continue
+			}
+			rule := ext.(*annotations.HttpRule)
+			rules[md.GetName()] = append([]*annotations.HttpRule{rule},
+				rule.AdditionalBindings...,
+			)
+		}
+	}
+	return rules
+}
+
+// httpPattern returns the HTTP method and path template of a rule
+func httpPattern(rule *annotations.HttpRule) (method, path string) {
+	switch p := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		return GET, p.Get
+	case *annotations.HttpRule_Put:
+		return PUT, p.Put
+	case *annotations.HttpRule_Post:
+		return POST, p.Post
+	case *annotations.HttpRule_Delete:
+		return DELETE, p.Delete
+	case *annotations.HttpRule_Patch:
+		return PATCH, p.Patch
+	case *annotations.HttpRule_Custom:
+		return p.Custom.GetKind(), p.Custom.GetPath()
+	}
+	return "", ""
+}
+
+var templateVar = regexp.MustCompile(`\{([^}=]+)(=([^}]*))?\}`)
+
+// muxPath converts a google.api.http path template to a mux route, e.g.
+// /v1/{name=shelves/*} becomes /v1/{name:shelves/[^/]+}
+func muxPath(template string) string {
+	return templateVar.ReplaceAllStringFunc(template, func(s string) string {
+		sub := templateVar.FindStringSubmatch(s)
+		if sub[2] == "" {
+			return "{" + sub[1] + "}"
+		}
+		segments := strings.Split(sub[3], "/")
+		for i, seg := range segments {
+			switch seg {
+			case "*":
+				segments[i] = "[^/]+"
+			case "**":
+				segments[i] = ".+"
+			default:
+				segments[i] = regexp.QuoteMeta(seg)
+			}
+		}
+		return "{" + sub[1] + ":" + strings.Join(segments, "/") + "}"
+	})
+}
+
+// httpStatus maps a gRPC code to an HTTP status code
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return StatusBadRequest
+	case codes.DeadlineExceeded:
+		return StatusGatewayTimeout
+	case codes.NotFound:
+		return StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return StatusConflict
+	case codes.PermissionDenied:
+		return StatusForbidden
+	case codes.Unauthenticated:
+		return StatusUnauthorized
+	case codes.ResourceExhausted:
+		return StatusTooManyRequests
+	case codes.Unimplemented:
+		return StatusNotImplemented
+	case codes.Unavailable:
+		return StatusServiceUnavailable
+	}
+	return StatusInternalServerError
+}
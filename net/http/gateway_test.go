@@ -0,0 +1,257 @@
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	netHttp "net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/stairlin/lego/ctx/journey"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	"github.com/stairlin/lego/net/http"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGateway(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx("test-http")
+	appCtx.Config().Request.AllowContext = true
+
+	g := lgrpc.NewServer()
+	g.RegisterService(&_Greeter_serviceDesc, &greeter{})
+	h := http.NewServer()
+	h.HandleGRPC(g)
+	addr := startServer(appCtx, h)
+
+	// Annotated method, with the journey propagated down to the service
+	ctx := journey.New(appCtx)
+	ctx.Store("lang", "fr")
+	client := http.Client{PropagateContext: true}
+	res, err := client.Get(ctx, fmt.Sprintf("http://%s/v1/greetings/bob", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeGreeting(t, res); got != "bonjour bob" {
+		t.Errorf("expect greeting to be \"bonjour bob\", but got %q", got)
+	}
+
+	// Convention
+	res, err = http.Post(journey.New(appCtx),
+		fmt.Sprintf("http://%s/lego.test.Greeter/Hello", addr),
+		"application/json",
+		strings.NewReader(`{"name": "alice"}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeGreeting(t, res); got != "hello alice" {
+		t.Errorf("expect greeting to be \"hello alice\", but got %q", got)
+	}
+
+	// Errors are mapped to HTTP status codes
+	res, err = http.Post(journey.New(appCtx),
+		fmt.Sprintf("http://%s/lego.test.Greeter/Hello", addr),
+		"application/json",
+		strings.NewReader(`{}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expect status 400, but got %d", res.StatusCode)
+	}
+
+	// Missing responses are reported as internal errors
+	res, err = http.Post(journey.New(appCtx),
+		fmt.Sprintf("http://%s/lego.test.Greeter/Hello", addr),
+		"application/json",
+		strings.NewReader(`{"name": "nobody"}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expect status 500, but got %d", res.StatusCode)
+	}
+
+	// 64-bit integers keep their precision
+	res, err = http.Post(journey.New(appCtx),
+		fmt.Sprintf("http://%s/lego.test.Greeter/Echo", addr),
+		"application/json",
+		strings.NewReader(`{"positive_int_value": 9007199254740993}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expect status 200, but got %d", res.StatusCode)
+	}
+	var echo struct {
+		Value string `json:"positive_int_value"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&echo); err != nil {
+		t.Fatal(err)
+	}
+	if echo.Value != "9007199254740993" {
+		t.Errorf("expect value to be 9007199254740993, but got %s", echo.Value)
+	}
+}
+
+func decodeGreeting(t *testing.T, res *netHttp.Response) string {
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expect status 200, but got %d", res.StatusCode)
+	}
+	var v struct {
+		Greeting string `json:"greeting"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v.Greeting
+}
+
+type greeter struct{}
+
+func (g *greeter) Hello(
+	ctx context.Context, req *structpb.Struct,
+) (*structpb.Struct, error) {
+	name := req.Fields["name"].GetStringValue()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing name")
+	}
+	if name == "nobody" {
+		return nil, nil
+	}
+	greeting := "hello"
+	if lang, ok := ctx.(journey.Ctx).Load("lang").(string); ok && lang == "fr" {
+		greeting = "bonjour"
+	}
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"greeting": {Kind: &structpb.Value_StringValue{
+			StringValue: greeting + " " + name,
+		}},
+	}}, nil
+}
+
+func _Greeter_Hello_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*greeter).Hello(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lego.test.Greeter/Hello",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*greeter).Hello(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func (g *greeter) Echo(
+	ctx context.Context, req *descriptor.UninterpretedOption,
+) (*descriptor.UninterpretedOption, error) {
+	return req, nil
+}
+
+func _Greeter_Echo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(descriptor.UninterpretedOption)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*greeter).Echo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lego.test.Greeter/Echo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*greeter).Echo(ctx, req.(*descriptor.UninterpretedOption))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Greeter_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "lego.test.Greeter",
+	HandlerType: (*greeter)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Hello",
+			Handler:    _Greeter_Hello_Handler,
+		},
+		{
+			MethodName: "Echo",
+			Handler:    _Greeter_Echo_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "net/http/gateway_test.proto",
+}
+
+// init registers the descriptor of a Greeter service, whose Hello method is
+// annotated with GET /v1/greetings/{name}, and whose Echo method follows the
+// convention
+func init() {
+	opts := &descriptor.MethodOptions{}
+	err := proto.SetExtension(opts, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/greetings/{name}"},
+		AdditionalBindings: []*annotations.HttpRule{{
+			Pattern: &annotations.HttpRule_Post{Post: "/lego.test.Greeter/Hello"},
+			Body:    "*",
+		}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	fd := &descriptor.FileDescriptorProto{
+		Name:    proto.String("net/http/gateway_test.proto"),
+		Package: proto.String("lego.test"),
+		Dependency: []string{
+			"google/api/annotations.proto",
+			"google/protobuf/descriptor.proto",
+			"google/protobuf/struct.proto",
+		},
+		Service: []*descriptor.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptor.MethodDescriptorProto{{
+				Name:       proto.String("Hello"),
+				InputType:  proto.String(".google.protobuf.Struct"),
+				OutputType: proto.String(".google.protobuf.Struct"),
+				Options:    opts,
+			}, {
+				Name:       proto.String("Echo"),
+				InputType:  proto.String(".google.protobuf.UninterpretedOption"),
+				OutputType: proto.String(".google.protobuf.UninterpretedOption"),
+			}},
+		}},
+		Syntax: proto.String("proto3"),
+	}
+	b, err := proto.Marshal(fd)
+	if err != nil {
+		panic(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	proto.RegisterFile("net/http/gateway_test.proto", buf.Bytes())
+}
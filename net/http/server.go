@@ -2,6 +2,8 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
+	stdnet "net"
 	"net/http"
 	"sync"
 	"sync/atomic"
@@ -13,6 +15,7 @@ import (
 	"github.com/stairlin/lego/ctx/journey"
 	"github.com/stairlin/lego/log"
 	"github.com/stairlin/lego/net"
+	"github.com/stairlin/lego/net/cert"
 )
 
 // A Server defines parameters for running a lego compatible HTTP server
@@ -26,8 +29,7 @@ type Server struct {
 	endpoints   []Endpoint
 	middlewares []Middleware
 
-	certFile string
-	keyFile  string
+	certSource cert.Source
 }
 
 // NewServer creates a new server and attaches the default middlewares
@@ -88,9 +90,16 @@ func (s *Server) Append(m Middleware) {
 // If the certificate is signed by a certificate authority, the certFile should
 // be the concatenation of the server's certificate, any intermediates,
 // and the CA's certificate.
+//
+// Files are reloaded periodically, so that certificates can be rotated.
 func (s *Server) ActivateTLS(certFile, keyFile string) {
-	s.certFile = certFile
-	s.keyFile = keyFile
+	s.ActivateTLSSource(cert.Files(certFile, keyFile, ""))
+}
+
+// ActivateTLSSource activates TLS on this handler with a certificate loaded
+// from src, which is reloaded periodically.
+func (s *Server) ActivateTLSSource(src cert.Source) {
+	s.certSource = src
 }
 
 // SetOptions changes the handler options
@@ -102,25 +111,45 @@ func (s *Server) SetOptions(opts ...Option) {
 
 // Serve starts serving HTTP requests (blocking call)
 func (s *Server) Serve(addr string, ctx app.Ctx) error {
+	lis, err := stdnet.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(lis, ctx)
+}
+
+// ServeListener starts serving HTTP requests on connections accepted by lis
+// (blocking call)
+func (s *Server) ServeListener(lis stdnet.Listener, ctx app.Ctx) error {
 	r := mux.NewRouter()
 	for _, e := range s.endpoints {
 		e.Attach(r, s.buildHandleFunc(ctx, e))
 	}
 
-	s.http.Addr = addr
+	s.http.Addr = lis.Addr().String()
 	s.http.Handler = r
 
-	tlsEnabled := s.certFile != "" && s.keyFile != ""
-	ctx.Trace("s.http.listen", "Listening...", log.String("addr", addr),
+	tlsEnabled := s.certSource != nil
+	ctx.Trace("s.http.listen", "Listening...", log.String("addr", s.http.Addr),
 		log.Bool("tls", tlsEnabled),
 	)
 
 	atomic.StoreUint32(&s.state, net.StateUp)
 	var err error
 	if tlsEnabled {
-		err = s.http.ListenAndServeTLS(s.certFile, s.keyFile)
+		m := cert.NewManager(s.certSource, ctx.L(), ctx.Stats())
+		defer m.Close()
+
+		config := &tls.Config{}
+		if s.http.TLSConfig != nil {
+			config = s.http.TLSConfig.Clone()
+		}
+		config.GetCertificate = m.GetCertificate
+		s.http.TLSConfig = config
+		err = s.http.ServeTLS(lis, "", "")
+	} else {
+		err = s.http.Serve(lis)
 	}
-	err = s.http.ListenAndServe()
 	atomic.StoreUint32(&s.state, net.StateDown)
 
 	if err == http.ErrServerClosed {
@@ -0,0 +1,252 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stairlin/lego/ctx/app"
+	"github.com/stairlin/lego/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// DefaultSniffTimeout is the default time given to a connection to send the
+// first bytes of its first request
+const DefaultSniffTimeout = 5 * time.Second
+
+// errListenerClosed is the error returned by Accept once a listener has
+// been closed
+var errListenerClosed = errors.New("listener closed")
+
+// ListenerServer is a server which can serve connections accepted by any
+// listener
+type ListenerServer interface {
+	Server
+	ServeListener(lis net.Listener, ctx app.Ctx) error
+}
+
+// Mux is a server which serves gRPC and HTTP requests on the same address.
+// HTTP/2 connections whose first request has an application/grpc content-type
+// are routed to the gRPC server, and all other connections to the HTTP server.
+//
+// Connections are not encrypted by the mux, so TLS should be terminated
+// upstream.
+type Mux struct {
+	mode uint32
+
+	lis  net.Listener
+	grpc *muxListener
+	http *muxListener
+
+	GRPC ListenerServer
+	HTTP ListenerServer
+
+	// SniffTimeout is the maximum time to wait for the first request of a
+	// connection before routing it (DefaultSniffTimeout when zero)
+	SniffTimeout time.Duration
+}
+
+// NewMux creates a server which serves grpc and http on the same address
+func NewMux(grpc, http ListenerServer) *Mux {
+	return &Mux{
+		GRPC: grpc,
+		HTTP: http,
+	}
+}
+
+// Serve starts serving gRPC and HTTP requests (blocking call)
+func (m *Mux) Serve(addr string, ctx app.Ctx) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	m.lis = lis
+	m.grpc = newMuxListener(lis.Addr())
+	m.http = newMuxListener(lis.Addr())
+
+	ctx.Trace("s.mux.listen", "Listening...", log.String("addr", addr))
+	atomic.StoreUint32(&m.mode, StateUp)
+	defer atomic.StoreUint32(&m.mode, StateDown)
+
+	errc := make(chan error, 2)
+	serve := func(s ListenerServer, l *muxListener) {
+		errc <- s.ServeListener(l, ctx)
+		if !m.isDraining() {
+			// Stop accepting connections which could not be served anymore
+			lis.Close()
+		}
+	}
+	go serve(m.GRPC, m.grpc)
+	go serve(m.HTTP, m.http)
+
+	var acceptErr error
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if !m.isDraining() {
+				acceptErr = err
+			}
+			break
+		}
+		go m.route(conn)
+	}
+
+	// Wait for both servers to stop. The listeners are closed when the mux
+	// stopped on its own, so that the other server returns too.
+	if acceptErr != nil {
+		m.grpc.Close()
+		m.http.Close()
+	}
+	errs := []error{<-errc, <-errc, acceptErr}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drain stops accepting new connections and drains both servers
+func (m *Mux) Drain() {
+	atomic.StoreUint32(&m.mode, StateDrain)
+	m.lis.Close()
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		m.GRPC.Drain()
+		wg.Done()
+	}()
+	go func() {
+		m.HTTP.Drain()
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+// isDraining checks whether the mux is draining
+func (m *Mux) isDraining() bool {
+	return atomic.LoadUint32(&m.mode) == StateDrain
+}
+
+// route sniffs the first bytes of conn to pass it to the right server
+func (m *Mux) route(conn net.Conn) {
+	timeout := m.SniffTimeout
+	if timeout == 0 {
+		timeout = DefaultSniffTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := &bytes.Buffer{}
+	grpc := isGRPC(conn, io.TeeReader(conn, buf))
+	conn.SetReadDeadline(time.Time{})
+
+	c := &sniffedConn{Conn: conn, r: io.MultiReader(buf, conn)}
+	if grpc {
+		m.grpc.push(c)
+	} else {
+		m.http.push(c)
+	}
+}
+
+// isGRPC tells whether r starts with the HTTP/2 client preface followed by
+// a request whose content-type is application/grpc.
+//
+// Some clients, such as grpc-go, wait for the server settings before sending
+// their first request, so settings are written to w once the preface has
+// been read.
+func isGRPC(w io.Writer, r io.Reader) bool {
+	preface := make([]byte, len(http2.ClientPreface))
+	for n := 0; n < len(preface); {
+		m, err := r.Read(preface[n:])
+		n += m
+		if !strings.HasPrefix(http2.ClientPreface, string(preface[:n])) {
+			return false
+		}
+		if err != nil {
+			return false
+		}
+	}
+
+	framer := http2.NewFramer(w, r)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := framer.WriteSettings(); err != nil {
+		return false
+	}
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			return false
+		}
+		h, ok := f.(*http2.MetaHeadersFrame)
+		if !ok {
+			continue
+		}
+		for _, field := range h.RegularFields() {
+			if field.Name == "content-type" {
+				return strings.HasPrefix(field.Value, "application/grpc")
+			}
+		}
+		return false
+	}
+}
+
+// sniffedConn is a connection which replays the bytes read while sniffing
+type sniffedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// muxListener is a listener which accepts the connections routed to it
+type muxListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newMuxListener(addr net.Addr) *muxListener {
+	return &muxListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *muxListener) push(c net.Conn) {
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Addr: l.addr,
+			Err: errListenerClosed,
+		}
+	}
+}
+
+func (l *muxListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,116 @@
+package net_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/ctx/app"
+	"github.com/stairlin/lego/ctx/journey"
+	"github.com/stairlin/lego/net"
+	lgrpc "github.com/stairlin/lego/net/grpc"
+	"github.com/stairlin/lego/net/http"
+	lt "github.com/stairlin/lego/testing"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestMux tests whether HTTP and gRPC requests can be served on the same
+// address
+func TestMux(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx(t.Name())
+
+	h := http.NewServer()
+	h.HandleFunc("/ping", http.GET, func(
+		ctx journey.Ctx, w http.ResponseWriter, r *http.Request,
+	) {
+		w.Head(http.StatusOK)
+	})
+	g := lgrpc.NewServer()
+	m := net.NewMux(g, h)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", lt.NextPort())
+	errc := make(chan error, 1)
+	go func() { errc <- m.Serve(addr, appCtx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// HTTP
+	res, err := http.Get(journey.New(appCtx), fmt.Sprintf("http://%s/ping", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expect status 200, but got %d", res.StatusCode)
+	}
+
+	// gRPC
+	c, err := lgrpc.NewClient(appCtx, addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	hres, err := healthpb.NewHealthClient(c.GRPC).Check(ctx,
+		&healthpb.HealthCheckRequest{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hres.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expect gRPC server to be SERVING, but got %s", hres.Status)
+	}
+	c.Close()
+
+	m.Drain()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Error("expect Serve to return without error", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expect Serve to return once drained")
+	}
+}
+
+// TestMuxServerError tests whether Serve returns when one of the servers
+// stops on its own
+func TestMuxServerError(t *testing.T) {
+	tt := lt.New(t)
+	appCtx := tt.NewAppCtx(t.Name())
+
+	errFailed := errors.New("failed")
+	m := net.NewMux(&failingServer{err: errFailed}, http.NewServer())
+
+	addr := fmt.Sprintf("127.0.0.1:%d", lt.NextPort())
+	errc := make(chan error, 1)
+	go func() { errc <- m.Serve(addr, appCtx) }()
+
+	select {
+	case err := <-errc:
+		if err != errFailed {
+			t.Errorf("expect Serve to return %s, but got %v", errFailed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect Serve to return when a server fails")
+	}
+}
+
+// failingServer is a server which fails as soon as it starts serving
+type failingServer struct {
+	err error
+}
+
+func (s *failingServer) Serve(addr string, ctx app.Ctx) error {
+	return s.err
+}
+
+func (s *failingServer) ServeListener(lis stdnet.Listener, ctx app.Ctx) error {
+	return s.err
+}
+
+func (s *failingServer) Drain() {}
@@ -33,7 +33,10 @@ type discoResolver struct {
 }
 
 func (r *discoResolver) Resolve(target string) (Watcher, error) {
-	svc, err := r.ctx.Disco().Service(r.ctx, target, r.tags...)
+	svc, err := r.ctx.Disco().Service(r.ctx, target,
+		disco.WithTags(r.tags...),
+		disco.OnlyPassing(),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -64,8 +67,9 @@ func (w *discoWatcher) Next() ([]*Update, error) {
 		case disco.Add:
 			w.instances[evt.Instance.ID] = evt.Instance
 			updates = append(updates, &Update{
-				Op:   Add,
-				Addr: evt.Instance.Addr(),
+				Op:       Add,
+				Addr:     evt.Instance.Addr(),
+				Metadata: evt.Instance,
 			})
 		case disco.Update:
 			inst, ok := w.instances[evt.Instance.ID]
@@ -73,6 +77,7 @@ func (w *discoWatcher) Next() ([]*Update, error) {
 				// TODO: Is this a realistic scenario?
 				continue
 			}
+			w.instances[evt.Instance.ID] = evt.Instance
 
 			// In case the address has changed
 			if inst.Addr() != evt.Instance.Addr() {
@@ -82,8 +87,9 @@ func (w *discoWatcher) Next() ([]*Update, error) {
 						Addr: inst.Addr(),
 					},
 					&Update{
-						Op:   Add,
-						Addr: evt.Instance.Addr(),
+						Op:       Add,
+						Addr:     evt.Instance.Addr(),
+						Metadata: evt.Instance,
 					},
 				)
 			}
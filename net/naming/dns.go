@@ -43,6 +43,9 @@ func DNS(ctx app.Ctx, freq ...time.Duration) Resolver {
 
 func buildDNS(ctx app.Ctx, uri *url.URL) (Watcher, error) {
 	target := strings.TrimPrefix(uri.Path, "/")
+	if target == "" {
+		target = uri.Host
+	}
 
 	fp := uri.Query().Get("freq")
 	if fp == "" {
@@ -2,6 +2,7 @@ package naming
 
 import (
 	"net/url"
+	"strings"
 
 	"github.com/stairlin/lego/ctx/app"
 )
@@ -11,8 +12,13 @@ func Passthrough(ctx app.Ctx) Resolver {
 	return &passThroughResolver{}
 }
 
+// buildPassthrough accepts both passthrough://addr and passthrough:///addr
 func buildPassthrough(ctx app.Ctx, uri *url.URL) (Watcher, error) {
-	return Passthrough(ctx).Resolve(uri.String())
+	target := uri.Host
+	if target == "" {
+		target = strings.TrimPrefix(uri.Path, "/")
+	}
+	return Passthrough(ctx).Resolve(target)
 }
 
 type passThroughResolver struct{}
@@ -0,0 +1,48 @@
+package retry
+
+import "sync"
+
+// Budget limits retries to a ratio of the successful calls, like the retry
+// throttling of gRPC.
+//
+// The budget starts with max tokens. Each failed call withdraws one token and
+// each successful call deposits ratio tokens. Retries are only allowed while
+// the budget holds more than half of its max tokens.
+type Budget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+// NewBudget creates a budget with the given max tokens and token ratio
+// (e.g. NewBudget(10, 0.1))
+func NewBudget(max int, ratio float64) *Budget {
+	return &Budget{
+		tokens: float64(max),
+		max:    float64(max),
+		ratio:  ratio,
+	}
+}
+
+// Withdraw records a failed call, and tells whether it can be retried
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens > 0 {
+		b.tokens--
+	}
+	return b.tokens > b.max/2
+}
+
+// Deposit records a successful call
+func (b *Budget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
@@ -0,0 +1,10 @@
+// Package retry defines the retry policies of the net/http and net/grpc
+// clients.
+//
+// A policy sets how many times a call is attempted, and how long to wait
+// between attempts (exponential backoff with jitter). Retries never go beyond
+// the deadline of the journey, and they can be limited by a budget shared
+// by the calls of a client, so that retries do not overload a failing service.
+//
+// A policy can be set on a client, and overridden for a call with WithPolicy.
+package retry
@@ -0,0 +1,124 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of times a call is attempted
+	DefaultMaxAttempts = 3
+	// DefaultMinBackoff is the default delay before the first retry
+	DefaultMinBackoff = 50 * time.Millisecond
+	// DefaultMaxBackoff is the default maximum delay between two attempts
+	DefaultMaxBackoff = time.Second
+)
+
+// Policy defines when and how calls are retried
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one
+	// (default: DefaultMaxAttempts)
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry. It doubles on every
+	// retry, up to MaxBackoff, and a random jitter of up to half the delay
+	// is subtracted from it.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Codes lists the retryable status codes. They are HTTP status codes for
+	// net/http clients, and gRPC codes for net/grpc clients. Each client has
+	// its own defaults when it is empty.
+	Codes []int
+	// Budget limits the number of retries (optional)
+	Budget *Budget
+}
+
+// Attempts returns the maximum number of attempts
+func (p *Policy) Attempts() int {
+	if p.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+// Retryable tells whether the given status code can be retried. def is
+// used when the policy does not define any code.
+func (p *Policy) Retryable(code int, def ...int) bool {
+	codes := p.Codes
+	if len(codes) == 0 {
+		codes = def
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before the given retry (starting at 1)
+func (p *Policy) Backoff(retry int) time.Duration {
+	min, max := p.MinBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	d := min
+	for i := 1; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d - time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// Allow tells whether a call can be retried after the given delay. It returns
+// false when the context would expire before, or when the budget is exhausted.
+func (p *Policy) Allow(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+	return p.Budget == nil || p.Budget.Withdraw()
+}
+
+// Success records a successful call in the budget
+func (p *Policy) Success() {
+	if p.Budget != nil {
+		p.Budget.Deposit()
+	}
+}
+
+// Sleep blocks for the given delay, or until the context is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type policyKey struct{}
+
+// WithPolicy returns a copy of ctx which overrides the retry policy of the
+// client for a call. A nil policy disables retries.
+func WithPolicy(ctx context.Context, p *Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// FromContext returns the policy set on ctx with WithPolicy, or def
+func FromContext(ctx context.Context, def *Policy) *Policy {
+	if p, ok := ctx.Value(policyKey{}).(*Policy); ok {
+		return p
+	}
+	return def
+}
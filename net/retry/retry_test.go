@@ -0,0 +1,88 @@
+package retry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stairlin/lego/net/retry"
+)
+
+// TestBackoff tests whether the backoff doubles up to the max backoff, with
+// a jitter of up to half the delay
+func TestBackoff(t *testing.T) {
+	p := &retry.Policy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{retry: 1, min: 5 * time.Millisecond, max: 10 * time.Millisecond},
+		{retry: 2, min: 10 * time.Millisecond, max: 20 * time.Millisecond},
+		{retry: 3, min: 15 * time.Millisecond, max: 30 * time.Millisecond},
+		{retry: 10, min: 15 * time.Millisecond, max: 30 * time.Millisecond},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			d := p.Backoff(test.retry)
+			if d < test.min || d > test.max {
+				t.Errorf("retry %d: expect backoff within [%s, %s], but got %s",
+					test.retry, test.min, test.max, d,
+				)
+			}
+		}
+	}
+}
+
+// TestAllowDeadline tests whether a retry is not allowed when the context
+// would expire before the end of the backoff
+func TestAllowDeadline(t *testing.T) {
+	p := &retry.Policy{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if !p.Allow(ctx, time.Millisecond) {
+		t.Error("expect retry to be allowed before the deadline")
+	}
+	if p.Allow(ctx, time.Second) {
+		t.Error("expect retry not to be allowed after the deadline")
+	}
+}
+
+// TestBudget tests whether a budget stops retries once half of its tokens
+// have been withdrawn, and allows them again after successful calls
+func TestBudget(t *testing.T) {
+	b := retry.NewBudget(4, 0.5)
+	p := &retry.Policy{Budget: b}
+	ctx := context.Background()
+
+	if !p.Allow(ctx, 0) {
+		t.Error("expect first retry to be allowed")
+	}
+	if p.Allow(ctx, 0) {
+		t.Error("expect second retry to exceed the budget")
+	}
+	for i := 0; i < 4; i++ {
+		p.Success()
+	}
+	if !p.Allow(ctx, 0) {
+		t.Error("expect retry to be allowed after successful calls")
+	}
+}
+
+// TestWithPolicy tests whether a policy set on a context overrides the
+// default one
+func TestWithPolicy(t *testing.T) {
+	def, p := &retry.Policy{}, &retry.Policy{}
+	if retry.FromContext(context.Background(), def) != def {
+		t.Error("expect default policy")
+	}
+	ctx := retry.WithPolicy(context.Background(), p)
+	if retry.FromContext(ctx, def) != p {
+		t.Error("expect policy from context")
+	}
+	ctx = retry.WithPolicy(context.Background(), nil)
+	if retry.FromContext(ctx, def) != nil {
+		t.Error("expect retries to be disabled")
+	}
+}